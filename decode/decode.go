@@ -14,6 +14,10 @@ import (
 // contentTypeKey is the "Content-Type" header key.
 var contentTypeKey = http.CanonicalHeaderKey("Content-Type")
 
+// MultipartMaxMemory is the maximum number of bytes of a multipart form stored in memory, the remaining file parts are stored in temporary files.
+// The body size itself is not limited (e.g. use the middleware.BodyLimit).
+var MultipartMaxMemory int64 = 32 << 20
+
 // Request decodes the request data based on the Content-Type header (query + content-type).
 func Request(r *http.Request, v interface{}) error {
 	if v == nil {
@@ -50,7 +54,9 @@ func Request(r *http.Request, v interface{}) error {
 			// form
 			if decodeForm {
 				if r.PostForm == nil {
-					r.ParseMultipartForm(32 << 20)
+					if err := parseForm(r); err != nil {
+						return err
+					}
 				}
 
 				value = resolveValue(r.PostForm, "form", tField)
@@ -144,7 +150,9 @@ func Form(r *http.Request, v interface{}) error {
 	}
 
 	// parse form
-	r.ParseMultipartForm(32 << 20)
+	if err := parseForm(r); err != nil {
+		return err
+	}
 
 	// resolve fields from type
 	tType := reflect.TypeOf(v).Elem()
@@ -190,6 +198,15 @@ func JSON(r *http.Request, v interface{}) error {
 	return nil
 }
 
+// parseForm parses the urlencoded or multipart form of the request.
+func parseForm(r *http.Request) error {
+	if strings.HasPrefix(r.Header.Get(contentTypeKey), "multipart/form-data") {
+		return r.ParseMultipartForm(MultipartMaxMemory)
+	}
+
+	return r.ParseForm()
+}
+
 // resolveValue returns the value for the field as string.
 func resolveValue(data url.Values, tag string, tField reflect.StructField) string {
 	key := tField.Tag.Get(tag)
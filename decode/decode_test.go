@@ -554,3 +554,30 @@ func TestFormUnknownStructType(t *testing.T) {
 	err := Form(r, tr)
 	assert.Error(t, err)
 }
+
+func TestFormBodyError(t *testing.T) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField("name", strings.Repeat("a", 1024))
+	mw.Close()
+
+	r, _ := http.NewRequest("POST", "/", body)
+	r.Header.Set("content-type", mw.FormDataContentType())
+	r.Body = http.MaxBytesReader(nil, r.Body, 100)
+
+	tr := new(testBaseReq)
+
+	err := Form(r, tr)
+	assert.Error(t, err)
+}
+
+func TestRequestFormBodyError(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/", strings.NewReader("name=test&email="+strings.Repeat("a", 1024)))
+	r.Header.Set("content-type", "application/x-www-form-urlencoded")
+	r.Body = http.MaxBytesReader(nil, r.Body, 100)
+
+	tr := new(testBaseReq)
+
+	err := Request(r, tr)
+	assert.Error(t, err)
+}
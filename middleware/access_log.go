@@ -0,0 +1,255 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var timeNow = time.Now
+var randFloat64 = rand.Float64
+
+// AccessLogFormat is the type for the access log formats.
+type AccessLogFormat int
+
+const (
+	// CommonLogFormat logs `host ident authuser [date] "request" status bytes "request-id" duration`.
+	CommonLogFormat AccessLogFormat = iota
+
+	// CombinedLogFormat logs the CommonLogFormat with the referer and user agent before the request id and duration.
+	CombinedLogFormat
+
+	// JSONLogFormat logs one json object per line.
+	JSONLogFormat
+)
+
+// redactedValue replaces redacted query values.
+const redactedValue = "REDACTED"
+
+// AccessLogOption is the type for the AccessLog options.
+type AccessLogOption func(*accessLog)
+
+// AccessLogRedactQuery replaces the values of the given query parameters with REDACTED.
+// Redacts all query values if no parameter is given.
+func AccessLogRedactQuery(params ...string) AccessLogOption {
+	return func(l *accessLog) {
+		l.redactQuery = true
+		l.redactParams = params
+	}
+}
+
+// AccessLogSample2xx logs only the given fraction (0 to 1) of the requests with a 2xx status.
+// All other requests are always logged.
+func AccessLogSample2xx(rate float64) AccessLogOption {
+	return func(l *accessLog) {
+		l.sample2xx = rate
+	}
+}
+
+// accessLog holds the AccessLog configuration.
+type accessLog struct {
+	mu           sync.Mutex
+	w            io.Writer
+	format       AccessLogFormat
+	redactQuery  bool
+	redactParams []string
+	sample2xx    float64
+}
+
+// accessLogEntry is the json access log entry.
+type accessLogEntry struct {
+	Time       string  `json:"time"`
+	RequestID  string  `json:"request_id,omitempty"`
+	RemoteIP   string  `json:"remote_ip"`
+	User       string  `json:"user,omitempty"`
+	Method     string  `json:"method"`
+	URI        string  `json:"uri"`
+	Proto      string  `json:"proto"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	DurationMS float64 `json:"duration_ms"`
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"user_agent,omitempty"`
+
+	start time.Time
+}
+
+// AccessLog writes an access log entry for every request into w.
+// Each entry contains the request id (see RequestID, must be executed before AccessLog), status, bytes, duration, remote ip and, in the Combined and JSON format, the user agent.
+func AccessLog(w io.Writer, format AccessLogFormat, options ...AccessLogOption) func(http.Handler) http.Handler {
+	l := &accessLog{
+		w:         w,
+		format:    format,
+		sample2xx: 1,
+	}
+
+	for _, option := range options {
+		option(l)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := timeNow()
+			rw := newResponseWriter(w)
+
+			next.ServeHTTP(rw, r)
+
+			status := rw.Status()
+			if status >= 200 && status < 300 && l.sample2xx < 1 && randFloat64() >= l.sample2xx {
+				return
+			}
+
+			l.write(l.entry(r, start, timeNow().Sub(start), status, rw.Size()))
+		})
+	}
+}
+
+// entry returns the log entry of the request.
+func (l *accessLog) entry(r *http.Request, start time.Time, duration time.Duration, status int, size int64) accessLogEntry {
+	user, _, _ := r.BasicAuth()
+
+	return accessLogEntry{
+		Time:       start.Format(time.RFC3339Nano),
+		RequestID:  GetRequestID(r.Context()),
+		RemoteIP:   remoteIP(r),
+		User:       user,
+		Method:     r.Method,
+		URI:        l.uri(r),
+		Proto:      r.Proto,
+		Status:     status,
+		Bytes:      size,
+		DurationMS: float64(duration) / float64(time.Millisecond),
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+		start:      start,
+	}
+}
+
+// write writes the formatted entry.
+func (l *accessLog) write(e accessLogEntry) {
+	var line []byte
+
+	if l.format == JSONLogFormat {
+		line, _ = json.Marshal(e)
+		line = append(line, '\n')
+	} else {
+		line = l.formatCommon(e)
+	}
+
+	l.mu.Lock()
+	l.w.Write(line)
+	l.mu.Unlock()
+}
+
+// formatCommon formats the entry in the Common or Combined Log Format.
+func (l *accessLog) formatCommon(e accessLogEntry) []byte {
+	b := make([]byte, 0, 256)
+	b = append(b, dash(e.RemoteIP)...)
+	b = append(b, " - "...)
+	b = append(b, dash(e.User)...)
+	b = append(b, " ["...)
+	b = append(b, e.start.Format("02/Jan/2006:15:04:05 -0700")...)
+	b = append(b, "] "...)
+	b = strconv.AppendQuote(b, e.Method+" "+e.URI+" "+e.Proto)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(e.Status), 10)
+	b = append(b, ' ')
+
+	if e.Bytes == 0 {
+		b = append(b, '-')
+	} else {
+		b = strconv.AppendInt(b, e.Bytes, 10)
+	}
+
+	if l.format == CombinedLogFormat {
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, dash(e.Referer))
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, dash(e.UserAgent))
+	}
+
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, dash(e.RequestID))
+	b = append(b, ' ')
+	b = strconv.AppendFloat(b, e.DurationMS/1000, 'f', 6, 64)
+	b = append(b, '\n')
+
+	return b
+}
+
+// uri returns the request uri with the redacted query values.
+func (l *accessLog) uri(r *http.Request) string {
+	uri := r.RequestURI
+	if uri == "" {
+		uri = r.URL.RequestURI()
+	}
+
+	if !l.redactQuery {
+		return uri
+	}
+
+	i := strings.IndexByte(uri, '?')
+	if i == -1 {
+		return uri
+	}
+
+	return uri[:i+1] + redactQuery(uri[i+1:], l.redactParams)
+}
+
+// redactQuery replaces the values of the given params in the raw query, all values if params is empty.
+func redactQuery(query string, params []string) string {
+	parts := strings.Split(query, "&")
+
+	for i, part := range parts {
+		key := part
+		if j := strings.IndexByte(part, '='); j != -1 {
+			key = part[:j]
+		}
+
+		if len(params) > 0 {
+			name, err := url.QueryUnescape(key)
+			if err != nil || !containsParam(params, name) {
+				continue
+			}
+		}
+
+		parts[i] = key + "=" + redactedValue
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// containsParam checks if params contains name.
+func containsParam(params []string, name string) bool {
+	for _, param := range params {
+		if param == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remoteIP returns the client ip resolved by RealIP or the ip of the request remote address.
+func remoteIP(r *http.Request) string {
+	if ip := ClientIP(r.Context()); ip != "" {
+		return ip
+	}
+
+	return peerIP(r)
+}
+
+// dash returns "-" for an empty string.
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newAccessLogTestHandler(log func(http.Handler) http.Handler) http.Handler {
+	return log(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte("hello"))
+	}))
+}
+
+func newAccessLogTestRequest(target string) *http.Request {
+	req := httptest.NewRequest("GET", target, nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("Referer", "http://example.com/")
+
+	return req
+}
+
+func setAccessLogTime(t *testing.T) {
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	calls := 0
+
+	timeNow = func() time.Time {
+		calls++
+		if calls%2 == 0 {
+			return start.Add(1500 * time.Microsecond)
+		}
+
+		return start
+	}
+
+	t.Cleanup(func() {
+		timeNow = time.Now
+	})
+}
+
+func TestAccessLogCommon(t *testing.T) {
+	setAccessLogTime(t)
+
+	buf := &bytes.Buffer{}
+	handler := newAccessLogTestHandler(AccessLog(buf, CommonLogFormat))
+
+	req := newAccessLogTestRequest("/path?a=1")
+	req = req.WithContext(context.WithValue(req.Context(), RequestIDContextKey, "id-1"))
+	req.SetBasicAuth("user", "pass")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "10.0.0.1 - user [02/Jan/2020:03:04:05 +0000] \"GET /path?a=1 HTTP/1.1\" 200 5 \"id-1\" 0.001500\n", buf.String())
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	setAccessLogTime(t)
+
+	buf := &bytes.Buffer{}
+	handler := newAccessLogTestHandler(AccessLog(buf, CombinedLogFormat))
+
+	req := newAccessLogTestRequest("/missing")
+	req.Header.Set("User-Agent", "agent \"quoted\"")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "10.0.0.1 - - [02/Jan/2020:03:04:05 +0000] \"GET /missing HTTP/1.1\" 404 19 \"http://example.com/\" \"agent \\\"quoted\\\"\" \"-\" 0.001500\n", buf.String())
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	setAccessLogTime(t)
+
+	buf := &bytes.Buffer{}
+	handler := newAccessLogTestHandler(AccessLog(buf, JSONLogFormat))
+
+	req := newAccessLogTestRequest("/path")
+	req = req.WithContext(context.WithValue(req.Context(), RequestIDContextKey, "id-2"))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.True(t, strings.HasSuffix(buf.String(), "\n"))
+
+	entry := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, map[string]interface{}{
+		"time":        "2020-01-02T03:04:05Z",
+		"request_id":  "id-2",
+		"remote_ip":   "10.0.0.1",
+		"method":      "GET",
+		"uri":         "/path",
+		"proto":       "HTTP/1.1",
+		"status":      float64(200),
+		"bytes":       float64(5),
+		"duration_ms": 1.5,
+		"referer":     "http://example.com/",
+		"user_agent":  "test-agent",
+	}, entry)
+}
+
+func TestAccessLogRedactQuery(t *testing.T) {
+	buf := &bytes.Buffer{}
+	handler := newAccessLogTestHandler(AccessLog(buf, JSONLogFormat, AccessLogRedactQuery("token", "pass word")))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newAccessLogTestRequest("/path?a=1&token=secret&pass+word=x&token"))
+	assert.Contains(t, buf.String(), "\"uri\":\"/path?a=1\\u0026token=REDACTED\\u0026pass+word=REDACTED\\u0026token=REDACTED\"")
+
+	buf.Reset()
+	handler = newAccessLogTestHandler(AccessLog(buf, CommonLogFormat, AccessLogRedactQuery()))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newAccessLogTestRequest("/path?a=1&b=2"))
+	assert.Contains(t, buf.String(), "\"GET /path?a=REDACTED&b=REDACTED HTTP/1.1\"")
+
+	buf.Reset()
+	handler.ServeHTTP(httptest.NewRecorder(), newAccessLogTestRequest("/path"))
+	assert.Contains(t, buf.String(), "\"GET /path HTTP/1.1\"")
+}
+
+func TestAccessLogSample2xx(t *testing.T) {
+	defer func() {
+		randFloat64 = rand.Float64
+	}()
+
+	buf := &bytes.Buffer{}
+	handler := newAccessLogTestHandler(AccessLog(buf, CommonLogFormat, AccessLogSample2xx(0.1)))
+
+	randFloat64 = func() float64 { return 0.5 }
+	handler.ServeHTTP(httptest.NewRecorder(), newAccessLogTestRequest("/path"))
+	assert.Equal(t, "", buf.String())
+
+	// non 2xx responses are always logged
+	handler.ServeHTTP(httptest.NewRecorder(), newAccessLogTestRequest("/missing"))
+	assert.Contains(t, buf.String(), " 404 ")
+
+	buf.Reset()
+	randFloat64 = func() float64 { return 0.05 }
+	handler.ServeHTTP(httptest.NewRecorder(), newAccessLogTestRequest("/path"))
+	assert.Contains(t, buf.String(), " 200 ")
+}
+
+func TestRemoteIP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+
+	req.RemoteAddr = "[::1]:80"
+	assert.Equal(t, "::1", remoteIP(req))
+
+	req.RemoteAddr = "unix"
+	assert.Equal(t, "unix", remoteIP(req))
+}
@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/fabysdev/fabyscore-go/server"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PrincipalContextKey is the authenticated principal context key.
+var PrincipalContextKey = &server.ContextKey{"principal"}
+
+// BasicAuthValidator is the type for the functions validating the basic auth credentials.
+type BasicAuthValidator func(username, password string) bool
+
+// BearerAuthValidator is the type for the functions validating a bearer token.
+// Returns the principal of the token (e.g. a user id) and whether the token is valid.
+type BearerAuthValidator func(token string) (string, bool)
+
+// BasicAuth authenticates the requests with the basic auth credentials, the username is the principal.
+// Responds with 401 and the WWW-Authenticate header with the realm if the credentials are missing or invalid.
+func BasicAuth(realm string, validator BasicAuthValidator) func(http.Handler) http.Handler {
+	challenge := fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", realm)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, password, ok := r.BasicAuth()
+			if !ok || !validator(username, password) {
+				unauthorized(w, challenge)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), PrincipalContextKey, username)))
+		})
+	}
+}
+
+// BearerAuth authenticates the requests with the bearer token of the Authorization header.
+// Responds with 401 and the WWW-Authenticate header if the token is missing or invalid.
+func BearerAuth(validator BearerAuthValidator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				unauthorized(w, "Bearer")
+				return
+			}
+
+			principal, ok := validator(token)
+			if !ok {
+				unauthorized(w, "Bearer error=\"invalid_token\"")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), PrincipalContextKey, principal)))
+		})
+	}
+}
+
+// Principal returns the authenticated principal from the given context.
+// Returns an empty string if no principal was found.
+func Principal(ctx context.Context) string {
+	if principal, ok := ctx.Value(PrincipalContextKey).(string); ok {
+		return principal
+	}
+
+	return ""
+}
+
+// BasicAuthUsers returns a BasicAuthValidator for the username/password map.
+// The credentials are compared in constant time.
+func BasicAuthUsers(users map[string]string) BasicAuthValidator {
+	hashed := make(map[string][32]byte, len(users))
+	for username, password := range users {
+		hashed[username] = sha256.Sum256([]byte(password))
+	}
+
+	return func(username, password string) bool {
+		expected, found := hashed[username]
+
+		// compare the fixed length hashes to not leak the password length
+		given := sha256.Sum256([]byte(password))
+		valid := subtle.ConstantTimeCompare(expected[:], given[:]) == 1
+
+		return found && valid
+	}
+}
+
+// LoadHtpasswd returns a BasicAuthValidator for the bcrypt entries of the htpasswd file.
+// Returns an error if the file can not be read or contains an entry which is not bcrypt hashed (htpasswd -B).
+func LoadHtpasswd(path string) (BasicAuthValidator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseHtpasswd(f)
+}
+
+// dummyBcryptHash is compared for unknown users to not leak the existing usernames by the response time.
+var dummyBcryptHash []byte
+var dummyBcryptHashOnce sync.Once
+
+// ParseHtpasswd returns a BasicAuthValidator for the bcrypt entries of the htpasswd content.
+// Empty lines and lines starting with # are ignored.
+func ParseHtpasswd(r io.Reader) (BasicAuthValidator, error) {
+	users := map[string][]byte{}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || entry[0] == '#' {
+			continue
+		}
+
+		i := strings.IndexByte(entry, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid htpasswd entry in line %d", line)
+		}
+
+		hash := entry[i+1:]
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("htpasswd entry in line %d is not bcrypt hashed", line)
+		}
+
+		users[entry[:i]] = []byte(hash)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return func(username, password string) bool {
+		hash, found := users[username]
+		if !found {
+			dummyBcryptHashOnce.Do(func() {
+				dummyBcryptHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+			})
+
+			bcrypt.CompareHashAndPassword(dummyBcryptHash, []byte(password))
+			return false
+		}
+
+		return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+	}, nil
+}
+
+// bearerToken returns the token of the Authorization header with the Bearer scheme.
+func bearerToken(r *http.Request) (string, bool) {
+	authorization := r.Header.Get("Authorization")
+
+	const prefix = "bearer "
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	token := strings.TrimSpace(authorization[len(prefix):])
+
+	return token, token != ""
+}
+
+// unauthorized responds with 401 and the WWW-Authenticate challenge.
+func unauthorized(w http.ResponseWriter, challenge string) {
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
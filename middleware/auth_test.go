@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var principalHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(Principal(r.Context())))
+})
+
+func TestBasicAuth(t *testing.T) {
+	handler := BasicAuth("admin area", BasicAuthUsers(map[string]string{"user": "secret"}))(principalHandler)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("user", "secret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user", w.Body.String())
+
+	tests := []func(r *http.Request){
+		func(r *http.Request) {},
+		func(r *http.Request) { r.SetBasicAuth("user", "wrong") },
+		func(r *http.Request) { r.SetBasicAuth("other", "secret") },
+		func(r *http.Request) { r.SetBasicAuth("user", "") },
+		func(r *http.Request) { r.Header.Set("Authorization", "Basic invalid") },
+	}
+
+	for _, setAuth := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		setAuth(req)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "Basic realm=\"admin area\", charset=\"UTF-8\"", w.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	handler := BearerAuth(func(token string) (string, bool) {
+		return "user-1", token == "valid"
+	})(principalHandler)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "bearer valid")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user-1", w.Body.String())
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer invalid")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer error=\"invalid_token\"", w.Header().Get("WWW-Authenticate"))
+
+	for _, authorization := range []string{"", "Bearer", "Bearer  ", "Basic dXNlcjpwYXNz"} {
+		req = httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", authorization)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code, authorization)
+		assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"), authorization)
+	}
+}
+
+func TestPrincipal(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	assert.Equal(t, "", Principal(req.Context()))
+}
+
+func TestLoadHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "htpasswd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".htpasswd")
+	ioutil.WriteFile(path, []byte("# users\n\nuser:"+string(hash)+"\n"), 0600)
+
+	validator, err := LoadHtpasswd(path)
+	assert.NoError(t, err)
+
+	assert.True(t, validator("user", "secret"))
+	assert.False(t, validator("user", "wrong"))
+	assert.False(t, validator("other", "secret"))
+
+	_, err = LoadHtpasswd(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestParseHtpasswdInvalid(t *testing.T) {
+	_, err := ParseHtpasswd(strings.NewReader("user:$apr1$abc$def\n"))
+	assert.EqualError(t, err, "htpasswd entry in line 1 is not bcrypt hashed")
+
+	_, err = ParseHtpasswd(strings.NewReader("# comment\ninvalid\n"))
+	assert.EqualError(t, err, "invalid htpasswd entry in line 2")
+}
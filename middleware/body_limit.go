@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/fabysdev/fabyscore-go/server"
+)
+
+// bodyLimitContextKey is the body limit state context key.
+var bodyLimitContextKey = &server.ContextKey{"body-limit"}
+
+// ErrBodyTooLarge is matched by the error of the request body if the body exceeds the limit (errors.Is).
+// The error wraps the error of http.MaxBytesReader.
+var ErrBodyTooLarge = errors.New("http: request body too large")
+
+// BodyLimitOption is the type for the BodyLimit options.
+type BodyLimitOption func(*bodyLimitConfig)
+
+// BodyLimitContentType sets the limit for a media type (e.g. multipart/form-data) or a media type prefix (e.g. image/).
+func BodyLimitContentType(contentType string, limit int64) BodyLimitOption {
+	return func(c *bodyLimitConfig) {
+		c.contentTypes = append(c.contentTypes, bodyLimitContentType{contentType: strings.ToLower(contentType), limit: limit})
+	}
+}
+
+// bodyLimitContentType is a content type specific limit.
+type bodyLimitContentType struct {
+	contentType string
+	limit       int64
+}
+
+// bodyLimitConfig holds the BodyLimit configuration.
+type bodyLimitConfig struct {
+	limit        int64
+	contentTypes []bodyLimitContentType
+}
+
+// limitFor returns the limit for the content type.
+func (c *bodyLimitConfig) limitFor(contentType string) int64 {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return c.limit
+	}
+
+	for _, ct := range c.contentTypes {
+		if mediaType == ct.contentType || (strings.HasSuffix(ct.contentType, "/") && strings.HasPrefix(mediaType, ct.contentType)) {
+			return ct.limit
+		}
+	}
+
+	return c.limit
+}
+
+// bodyLimitState is the body limit state of a request, shared by all BodyLimit middlewares of the request.
+type bodyLimitState struct {
+	w      http.ResponseWriter
+	source *bodyLimitSource
+	err    error
+}
+
+// BodyLimit limits the request body to n bytes with http.MaxBytesReader, the body returns an error matching ErrBodyTooLarge if the limit is exceeded.
+// The response is replaced with 413 if the limit was exceeded, regardless of the status written by the handler.
+// The innermost BodyLimit replaces the limits of the outer ones, e.g. a route BodyLimit overrides the server BodyLimit.
+func BodyLimit(n int64, options ...BodyLimitOption) func(http.Handler) http.Handler {
+	cfg := &bodyLimitConfig{limit: n}
+
+	for _, option := range options {
+		option(cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := cfg.limitFor(r.Header.Get("Content-Type"))
+
+			state, ok := r.Context().Value(bodyLimitContextKey).(*bodyLimitState)
+			if ok {
+				r.Body = newLimitedBody(state, limit, r.ContentLength)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			state = &bodyLimitState{w: w, source: &bodyLimitSource{ReadCloser: r.Body}}
+			bw := &bodyLimitWriter{responseWriter: newResponseWriter(w), state: state}
+
+			r = r.WithContext(context.WithValue(r.Context(), bodyLimitContextKey, state))
+			r.Body = newLimitedBody(state, limit, r.ContentLength)
+
+			next.ServeHTTP(bw, r)
+
+			if state.err != nil && !bw.wroteHeader && !bw.hijacked {
+				bw.WriteHeader(http.StatusRequestEntityTooLarge)
+			}
+		})
+	}
+}
+
+// bodyLimitSource is the original request body, it records the error of the last read.
+type bodyLimitSource struct {
+	io.ReadCloser
+	err error
+}
+
+// Read reads from the original body and records the error.
+func (s *bodyLimitSource) Read(p []byte) (int, error) {
+	n, err := s.ReadCloser.Read(p)
+	s.err = err
+
+	return n, err
+}
+
+// limitedBody is a request body limited by http.MaxBytesReader, an exceeded limit is recorded in the state.
+type limitedBody struct {
+	state *bodyLimitState
+	r     io.ReadCloser
+}
+
+// newLimitedBody returns the limited original body of the state.
+// Requests with a larger Content-Length fail on the first read.
+func newLimitedBody(state *bodyLimitState, limit int64, contentLength int64) *limitedBody {
+	if contentLength > limit {
+		limit = 0
+	}
+
+	return &limitedBody{state: state, r: http.MaxBytesReader(state.w, state.source, limit)}
+}
+
+// Read reads up to the limit, the errors which are not returned by the original body are limit errors.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.state.err != nil {
+		return 0, b.state.err
+	}
+
+	n, err := b.r.Read(p)
+	if err != nil && err != b.state.source.err {
+		return n, b.exceed(err)
+	}
+
+	return n, err
+}
+
+// Close closes the original body.
+func (b *limitedBody) Close() error {
+	return b.r.Close()
+}
+
+// exceed marks the limit as exceeded and closes the connection after the response.
+func (b *limitedBody) exceed(err error) error {
+	b.state.err = &bodyTooLargeError{err: err}
+	b.state.w.Header().Set("Connection", "close")
+
+	return b.state.err
+}
+
+// bodyTooLargeError is the error of an exceeded limit, it matches ErrBodyTooLarge and wraps the http.MaxBytesReader error.
+type bodyTooLargeError struct {
+	err error
+}
+
+// Error returns the message of the http.MaxBytesReader error.
+func (e *bodyTooLargeError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the http.MaxBytesReader error.
+func (e *bodyTooLargeError) Unwrap() error {
+	return e.err
+}
+
+// Is matches ErrBodyTooLarge.
+func (e *bodyTooLargeError) Is(target error) bool {
+	return target == ErrBodyTooLarge
+}
+
+// bodyLimitWriter is a http.ResponseWriter replacing the response with 413 if the body limit was exceeded.
+type bodyLimitWriter struct {
+	*responseWriter
+	state   *bodyLimitState
+	discard bool
+}
+
+// WriteHeader sends 413 instead of the status code if the body limit was exceeded.
+func (bw *bodyLimitWriter) WriteHeader(code int) {
+	if bw.wroteHeader {
+		return
+	}
+
+	if bw.state.err == nil {
+		bw.responseWriter.WriteHeader(code)
+		return
+	}
+
+	bw.discard = true
+
+	bw.Header().Del("Content-Length")
+	bw.Header().Del("Content-Encoding")
+
+	http.Error(bw.responseWriter, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+}
+
+// Write discards the data of a replaced response.
+func (bw *bodyLimitWriter) Write(b []byte) (int, error) {
+	if !bw.wroteHeader {
+		bw.WriteHeader(http.StatusOK)
+	}
+
+	if bw.discard {
+		return len(b), nil
+	}
+
+	return bw.responseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if the wrapped ResponseWriter supports it.
+func (bw *bodyLimitWriter) Flush() {
+	if !bw.wroteHeader {
+		bw.WriteHeader(http.StatusOK)
+	}
+
+	bw.responseWriter.Flush()
+}
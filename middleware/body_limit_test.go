@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fabysdev/fabyscore-go/decode"
+	"github.com/fabysdev/fabyscore-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+var readBodyHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.Header().Set("X-Error", err.Error())
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	w.Write(body)
+})
+
+func bodyLimitRequest(handler http.Handler, contentType, body string, chunked bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+
+	if chunked {
+		req.ContentLength = -1
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestBodyLimit(t *testing.T) {
+	handler := BodyLimit(10)(readBodyHandler)
+
+	w := bodyLimitRequest(handler, "text/plain", "1234567890", false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1234567890", w.Body.String())
+
+	w = bodyLimitRequest(handler, "text/plain", "1234567890", true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1234567890", w.Body.String())
+
+	for _, chunked := range []bool{false, true} {
+		w = bodyLimitRequest(handler, "text/plain", "12345678901", chunked)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Equal(t, "Request Entity Too Large\n", w.Body.String())
+		assert.Equal(t, "close", w.Header().Get("Connection"))
+		assert.Equal(t, ErrBodyTooLarge.Error(), w.Header().Get("X-Error"))
+	}
+
+	// the handler does not write a response
+	handler = BodyLimit(5)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+	}))
+
+	w = bodyLimitRequest(handler, "text/plain", "123456", true)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// no body
+	handler = BodyLimit(5)(readBodyHandler)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+type errorBody struct{}
+
+func (errorBody) Read(p []byte) (int, error) { return 0, errors.New("read failed") }
+func (errorBody) Close() error               { return nil }
+
+func TestBodyLimitErrors(t *testing.T) {
+	var readErr error
+	handler := BodyLimit(5)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = ioutil.ReadAll(r.Body)
+	}))
+
+	bodyLimitRequest(handler, "text/plain", "123456", true)
+	assert.True(t, errors.Is(readErr, ErrBodyTooLarge))
+	assert.NotNil(t, errors.Unwrap(readErr))
+
+	// errors of the original body are not limit errors
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Body = errorBody{}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.EqualError(t, readErr, "read failed")
+	assert.False(t, errors.Is(readErr, ErrBodyTooLarge))
+}
+
+func TestBodyLimitContentType(t *testing.T) {
+	handler := BodyLimit(5, BodyLimitContentType("multipart/form-data", 20), BodyLimitContentType("image/", 15))(readBodyHandler)
+
+	tests := []struct {
+		contentType string
+		size        int
+		status      int
+	}{
+		{"application/json", 5, http.StatusOK},
+		{"application/json", 6, http.StatusRequestEntityTooLarge},
+		{"multipart/form-data; boundary=x", 20, http.StatusOK},
+		{"Multipart/Form-Data; boundary=x", 21, http.StatusRequestEntityTooLarge},
+		{"image/png", 15, http.StatusOK},
+		{"image/png", 16, http.StatusRequestEntityTooLarge},
+		{"invalid;;", 6, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		w := bodyLimitRequest(handler, test.contentType, strings.Repeat("a", test.size), false)
+		assert.Equal(t, test.status, w.Code, test.contentType, test.size)
+	}
+}
+
+func TestBodyLimitOverride(t *testing.T) {
+	srv := server.New()
+	srv.Use(BodyLimit(5))
+	srv.POST("/json", readBodyHandler)
+	srv.POST("/upload", readBodyHandler, BodyLimit(20))
+	srv.Group("/small", func(g *server.Group) {
+		g.Use(BodyLimit(2))
+		g.POST("/", readBodyHandler)
+	})
+
+	tests := []struct {
+		path   string
+		size   int
+		status int
+	}{
+		{"/json", 5, http.StatusOK},
+		{"/json", 6, http.StatusRequestEntityTooLarge},
+		{"/upload", 20, http.StatusOK},
+		{"/upload", 21, http.StatusRequestEntityTooLarge},
+		{"/small/", 2, http.StatusOK},
+		{"/small/", 3, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		for _, chunked := range []bool{false, true} {
+			req := httptest.NewRequest("POST", test.path, strings.NewReader(strings.Repeat("a", test.size)))
+			if chunked {
+				req.ContentLength = -1
+			}
+
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			assert.Equal(t, test.status, w.Code, test.path, test.size, chunked)
+		}
+	}
+}
+
+func TestBodyLimitDecodeForm(t *testing.T) {
+	handler := BodyLimit(512)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := struct {
+			Name string `form:"name"`
+		}{}
+
+		if err := decode.Form(r, &v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Write([]byte(v.Name))
+	}))
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField("name", "fabys")
+	mw.Close()
+
+	w := bodyLimitRequest(handler, mw.FormDataContentType(), body.String(), false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "fabys", w.Body.String())
+
+	body = &bytes.Buffer{}
+	mw = multipart.NewWriter(body)
+	mw.WriteField("name", strings.Repeat("a", 1024))
+	mw.Close()
+
+	w = bodyLimitRequest(handler, mw.FormDataContentType(), body.String(), true)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
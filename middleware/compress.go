@@ -0,0 +1,397 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultCompressMinSize is the default minimum body size for the compression.
+const defaultCompressMinSize = 1024
+
+// defaultSkipContentTypes are the already compressed content types (prefix match).
+var defaultSkipContentTypes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+	"video/", "audio/", "font/woff", "font/woff2",
+	"application/zip", "application/gzip", "application/x-gzip", "application/x-bzip2", "application/x-7z-compressed", "application/x-rar-compressed",
+	"application/pdf", "application/octet-stream", "application/wasm",
+}
+
+// CompressOption is the type for the Compress options.
+type CompressOption func(*compressor)
+
+// CompressLevel sets the compression level (see compress/flate). Defaults to flate.DefaultCompression.
+func CompressLevel(level int) CompressOption {
+	return func(c *compressor) {
+		c.level = level
+	}
+}
+
+// CompressMinSize sets the minimum body size for the compression. Defaults to 1024 bytes.
+func CompressMinSize(size int) CompressOption {
+	return func(c *compressor) {
+		c.minSize = size
+	}
+}
+
+// CompressSkipContentTypes sets the content types (prefix match, e.g. image/png or video/) which are not compressed.
+func CompressSkipContentTypes(types ...string) CompressOption {
+	return func(c *compressor) {
+		c.skipContentTypes = types
+	}
+}
+
+// compressEncoder is the common interface of gzip.Writer and zlib.Writer.
+type compressEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressor holds the Compress configuration and the encoder pools.
+type compressor struct {
+	level            int
+	minSize          int
+	skipContentTypes []string
+
+	gzipPool    sync.Pool
+	deflatePool sync.Pool
+}
+
+// Compress compresses the response with gzip or deflate, negotiated by the Accept-Encoding q-values.
+// Bodies smaller than the minimum size, already compressed content types and responses with a Content-Encoding are not compressed.
+// Keeps the http.Flusher support, a flush compresses the data written so far regardless of the minimum size.
+func Compress(options ...CompressOption) func(http.Handler) http.Handler {
+	c := &compressor{
+		level:            gzip.DefaultCompression,
+		minSize:          defaultCompressMinSize,
+		skipContentTypes: defaultSkipContentTypes,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	// panics for invalid levels during the setup
+	if _, err := gzip.NewWriterLevel(ioutil.Discard, c.level); err != nil {
+		panic(err.Error())
+	}
+
+	c.gzipPool.New = func() interface{} {
+		w, _ := gzip.NewWriterLevel(ioutil.Discard, c.level)
+		return w
+	}
+
+	// the deflate content coding is the zlib format (RFC 1950), not raw deflate
+	c.deflatePool.New = func() interface{} {
+		w, _ := zlib.NewWriterLevel(ioutil.Discard, c.level)
+		return w
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Values("Accept-Encoding"))
+			if encoding == "" || r.Method == "HEAD" || r.Header.Get("Range") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				c:              c,
+				encoding:       encoding,
+			}
+
+			next.ServeHTTP(cw, r)
+
+			cw.Close()
+		})
+	}
+}
+
+// isCompressible checks if the content type is not skipped.
+func (c *compressor) isCompressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+
+	for _, skip := range c.skipContentTypes {
+		if strings.HasPrefix(contentType, skip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getEncoder returns a pooled encoder writing into w.
+func (c *compressor) getEncoder(encoding string, w io.Writer) compressEncoder {
+	var enc compressEncoder
+	if encoding == "gzip" {
+		enc = c.gzipPool.Get().(*gzip.Writer)
+	} else {
+		enc = c.deflatePool.Get().(*zlib.Writer)
+	}
+
+	enc.Reset(w)
+
+	return enc
+}
+
+// putEncoder adds the encoder back to the pool.
+func (c *compressor) putEncoder(encoding string, enc compressEncoder) {
+	enc.Reset(ioutil.Discard)
+
+	if encoding == "gzip" {
+		c.gzipPool.Put(enc)
+	} else {
+		c.deflatePool.Put(enc)
+	}
+}
+
+// compressWriter is a http.ResponseWriter buffering the body until the compression is decided.
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	encoding string
+
+	status   int
+	buf      []byte
+	decided  bool
+	hijacked bool
+	enc      compressEncoder
+}
+
+// WriteHeader records the status code, the header is sent after the compression is decided.
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.status != 0 || cw.decided {
+		return
+	}
+
+	cw.status = code
+}
+
+// Write buffers the data until the minimum size is reached and writes it compressed afterwards.
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		if len(cw.buf)+len(b) < cw.c.minSize {
+			cw.buf = append(cw.buf, b...)
+			return len(b), nil
+		}
+
+		if err := cw.decide(b, true); err != nil {
+			return 0, err
+		}
+
+		return len(b), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush decides the compression, compresses the buffered data and flushes it.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(nil, true)
+	}
+
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.
+// Returns an error if the wrapped ResponseWriter does not support it.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the ResponseWriter does not implement http.Hijacker")
+	}
+
+	conn, brw, err := h.Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+
+	return conn, brw, err
+}
+
+// Unwrap returns the wrapped ResponseWriter.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close writes the buffered data and closes the encoder.
+func (cw *compressWriter) Close() error {
+	if cw.hijacked {
+		return nil
+	}
+
+	if !cw.decided {
+		if err := cw.decide(nil, false); err != nil {
+			return err
+		}
+	}
+
+	if cw.enc == nil {
+		return nil
+	}
+
+	err := cw.enc.Close()
+	cw.c.putEncoder(cw.encoding, cw.enc)
+	cw.enc = nil
+
+	return err
+}
+
+// decide decides the compression, sends the header and writes the buffered data and b.
+// The minimum size is checked by the caller, sized is false if the body is smaller than the minimum size.
+func (cw *compressWriter) decide(b []byte, sized bool) error {
+	cw.decided = true
+
+	status := cw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	header := cw.Header()
+
+	compress := sized && header.Get("Content-Encoding") == "" && bodyAllowedForStatus(status)
+	if compress {
+		contentType := header.Get("Content-Type")
+		if contentType == "" && (len(cw.buf) > 0 || len(b) > 0) {
+			contentType = http.DetectContentType(append(cw.buf, b...))
+			header.Set("Content-Type", contentType)
+		}
+
+		compress = cw.c.isCompressible(contentType)
+	}
+
+	if compress {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", cw.encoding)
+		cw.enc = cw.c.getEncoder(cw.encoding, cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(status)
+
+	var w io.Writer = cw.ResponseWriter
+	if cw.enc != nil {
+		w = cw.enc
+	}
+
+	if len(cw.buf) > 0 {
+		if _, err := w.Write(cw.buf); err != nil {
+			return err
+		}
+
+		cw.buf = nil
+	}
+
+	if len(b) > 0 {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bodyAllowedForStatus checks if the status allows a response body.
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent:
+		return false
+	case status == http.StatusNotModified:
+		return false
+	}
+
+	return true
+}
+
+// negotiateEncoding returns gzip or deflate for the Accept-Encoding values with the highest q-value.
+// Prefers gzip if the q-values are equal. Returns an empty string if neither is accepted.
+func negotiateEncoding(values []string) string {
+	qs := map[string]float64{}
+	wildcard := -1.0
+
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			coding, q := parseAcceptEncoding(part)
+			if coding == "" {
+				continue
+			}
+
+			if coding == "*" {
+				wildcard = q
+				continue
+			}
+
+			qs[coding] = q
+		}
+	}
+
+	best := ""
+	bestQ := 0.0
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		q, ok := qs[encoding]
+		if !ok {
+			if encoding == "gzip" {
+				q, ok = qs["x-gzip"]
+			}
+
+			if !ok && wildcard >= 0 {
+				q, ok = wildcard, true
+			}
+		}
+
+		if ok && q > bestQ {
+			best = encoding
+			bestQ = q
+		}
+	}
+
+	return best
+}
+
+// parseAcceptEncoding returns the lowercase coding and the q-value of an Accept-Encoding element.
+func parseAcceptEncoding(part string) (string, float64) {
+	params := strings.Split(part, ";")
+	coding := strings.ToLower(strings.TrimSpace(params[0]))
+	q := 1.0
+
+	for _, param := range params[1:] {
+		param = strings.TrimSpace(param)
+		if len(param) < 2 || (param[0] != 'q' && param[0] != 'Q') || param[1] != '=' {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(strings.TrimSpace(param[2:]), 64)
+		if err != nil || v < 0 || v > 1 {
+			return "", 0
+		}
+
+		q = v
+	}
+
+	return coding, q
+}
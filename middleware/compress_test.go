@@ -0,0 +1,250 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCompressTestHandler(body string, options ...CompressOption) http.Handler {
+	return Compress(options...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.URL.Query().Get("type"); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+
+		w.Header().Set("Content-Length", "123")
+		w.Write([]byte(body))
+	}))
+}
+
+func TestCompressGzip(t *testing.T) {
+	body := strings.Repeat("hello world ", 200)
+	handler := newCompressTestHandler(body)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, "", w.Header().Get("Content-Length"))
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.True(t, w.Body.Len() < len(body))
+
+	zr, err := gzip.NewReader(w.Body)
+	assert.NoError(t, err)
+	decoded, _ := ioutil.ReadAll(zr)
+	assert.Equal(t, body, string(decoded))
+
+	// the pooled encoder is reused
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	zr, err = gzip.NewReader(w.Body)
+	assert.NoError(t, err)
+	decoded, _ = ioutil.ReadAll(zr)
+	assert.Equal(t, body, string(decoded))
+}
+
+func TestCompressDeflate(t *testing.T) {
+	body := strings.Repeat("hello world ", 200)
+	handler := newCompressTestHandler(body, CompressLevel(flate.BestSpeed))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0.5, deflate")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "deflate", w.Header().Get("Content-Encoding"))
+
+	zr, err := zlib.NewReader(w.Body)
+	assert.NoError(t, err)
+	decoded, _ := ioutil.ReadAll(zr)
+	assert.Equal(t, body, string(decoded))
+}
+
+func TestCompressSkipped(t *testing.T) {
+	large := strings.Repeat("a", 2000)
+
+	tests := []struct {
+		name           string
+		body           string
+		target         string
+		acceptEncoding string
+		method         string
+	}{
+		{"small body", "small", "/", "gzip", "GET"},
+		{"not accepted", large, "/", "br", "GET"},
+		{"identity", large, "/", "", "GET"},
+		{"compressed content type", large, "/?type=image/png", "gzip", "GET"},
+		{"head", large, "/", "gzip", "HEAD"},
+	}
+
+	for _, test := range tests {
+		handler := newCompressTestHandler(test.body)
+
+		req := httptest.NewRequest(test.method, test.target, nil)
+		req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, "", w.Header().Get("Content-Encoding"), test.name)
+		assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"), test.name)
+		assert.Equal(t, test.body, w.Body.String(), test.name)
+	}
+}
+
+func TestCompressExistingContentEncoding(t *testing.T) {
+	body := strings.Repeat("a", 2000)
+	handler := Compress()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(body))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "br", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, w.Body.String())
+}
+
+func TestCompressNoBody(t *testing.T) {
+	handler := Compress(CompressMinSize(0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, 0, w.Body.Len())
+}
+
+func TestCompressFlush(t *testing.T) {
+	next := make(chan bool)
+
+	handler := Compress()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+
+		<-next
+
+		w.Write([]byte("data: second\n\n"))
+	}))
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	res, err := http.DefaultTransport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+
+	zr, err := gzip.NewReader(res.Body)
+	assert.NoError(t, err)
+
+	// the first event is readable before the handler finishes
+	buf := make([]byte, 13)
+	done := make(chan bool)
+	go func() {
+		n, _ := zr.Read(buf)
+		assert.Equal(t, "data: first\n\n", string(buf[:n]))
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("flushed data was not received")
+	}
+
+	close(next)
+
+	rest, _ := ioutil.ReadAll(zr)
+	res.Body.Close()
+	assert.Equal(t, "data: second\n\n", string(rest))
+}
+
+func TestCompressInvalidLevelPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Compress did not panic")
+		}
+	}()
+
+	Compress(CompressLevel(42))
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                          "",
+		"gzip":                      "gzip",
+		"GZIP":                      "gzip",
+		"x-gzip":                    "gzip",
+		"deflate":                   "deflate",
+		"deflate, gzip":             "gzip",
+		"gzip;q=0.5, deflate;q=1":   "deflate",
+		"gzip;q=0, deflate;q=0":     "",
+		"br":                        "",
+		"*":                         "gzip",
+		"*;q=0.5, gzip;q=0":         "deflate",
+		"gzip;q=invalid":            "",
+		"gzip; Q=0.8, deflate;q=.9": "deflate",
+		"identity, *;q=0":           "",
+	}
+
+	for header, expected := range tests {
+		assert.Equal(t, expected, negotiateEncoding([]string{header}), header)
+	}
+
+	assert.Equal(t, "deflate", negotiateEncoding([]string{"br", "deflate"}))
+}
+
+func TestCompressWriterHijackNotSupported(t *testing.T) {
+	cw := &compressWriter{ResponseWriter: httptest.NewRecorder()}
+
+	_, _, err := cw.Hijack()
+	assert.Error(t, err)
+	assert.NotNil(t, cw.Unwrap())
+}
+
+func TestCompressWriterBuffersUntilMinSize(t *testing.T) {
+	w := httptest.NewRecorder()
+	c := &compressor{minSize: 10, skipContentTypes: defaultSkipContentTypes}
+	c.gzipPool.New = func() interface{} { return gzip.NewWriter(ioutil.Discard) }
+
+	cw := &compressWriter{ResponseWriter: w, c: c, encoding: "gzip"}
+	cw.Write([]byte("12345"))
+	assert.False(t, w.Flushed)
+	assert.Equal(t, 0, w.Body.Len())
+
+	cw.Write([]byte("67890"))
+	cw.Close()
+
+	zr, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+	assert.NoError(t, err)
+	decoded, _ := ioutil.ReadAll(zr)
+	assert.Equal(t, "1234567890", string(decoded))
+}
@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig is the configuration of the CORS middleware.
+type CORSConfig struct {
+	// AllowedOrigins are the allowed origins: exact (https://example.com), wildcard subdomains (https://*.example.com) or all (*).
+	AllowedOrigins []string
+
+	// AllowOriginFunc allows additional origins.
+	AllowOriginFunc func(origin string) bool
+
+	// AllowedMethods are the methods allowed in preflights. Defaults to GET, HEAD and POST.
+	AllowedMethods []string
+
+	// AllowedHeaders are the request headers allowed in preflights, * allows all headers.
+	AllowedHeaders []string
+
+	// ExposedHeaders are the response headers exposed to the client.
+	ExposedHeaders []string
+
+	// AllowCredentials allows requests with credentials (cookies, authorization headers), the origin is returned instead of *.
+	AllowCredentials bool
+
+	// MaxAge is the duration the preflight result can be cached.
+	MaxAge time.Duration
+}
+
+// cors holds the prepared CORSConfig.
+type cors struct {
+	cfg            CORSConfig
+	allowAll       bool
+	origins        map[string]bool
+	wildcards      [][2]string
+	methods        map[string]bool
+	allowedMethods string
+	allowAllHeader bool
+	headers        map[string]bool
+	exposedHeaders string
+}
+
+// CORS adds the Cross-Origin Resource Sharing headers and answers the preflight requests.
+// Preflights are answered with 204 without executing the route handler, the server answers OPTIONS requests automatically for routes without an OPTIONS handler.
+func CORS(cfg CORSConfig) func(http.Handler) http.Handler {
+	c := newCORS(cfg)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+				c.preflight(w, r)
+				return
+			}
+
+			c.actual(w, r)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// newCORS returns the prepared cors for the configuration.
+func newCORS(cfg CORSConfig) *cors {
+	c := &cors{
+		cfg:     cfg,
+		origins: map[string]bool{},
+		methods: map[string]bool{},
+		headers: map[string]bool{},
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(origin)
+
+		switch {
+		case origin == "*":
+			c.allowAll = true
+		case strings.Contains(origin, "*"):
+			i := strings.IndexByte(origin, '*')
+			c.wildcards = append(c.wildcards, [2]string{origin[:i], origin[i+1:]})
+		default:
+			c.origins[origin] = true
+		}
+	}
+
+	allowedMethods := cfg.AllowedMethods
+	if len(allowedMethods) == 0 {
+		allowedMethods = []string{"GET", "HEAD", "POST"}
+	}
+
+	methods := make([]string, len(allowedMethods))
+	for i, method := range allowedMethods {
+		methods[i] = strings.ToUpper(method)
+		c.methods[methods[i]] = true
+	}
+
+	c.allowedMethods = strings.Join(methods, ", ")
+
+	for _, header := range cfg.AllowedHeaders {
+		if header == "*" {
+			c.allowAllHeader = true
+			continue
+		}
+
+		c.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	c.exposedHeaders = strings.Join(cfg.ExposedHeaders, ", ")
+
+	return c
+}
+
+// preflight answers a preflight request.
+// The CORS headers are only added if the origin, method and headers are allowed.
+func (c *cors) preflight(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+
+	origin := r.Header.Get("Origin")
+	if c.isOriginAllowed(origin) && c.methods[strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))] {
+		requestHeaders, ok := c.requestHeaders(r)
+		if ok {
+			c.setAllowOrigin(header, origin)
+			header.Set("Access-Control-Allow-Methods", c.allowedMethods)
+
+			if len(requestHeaders) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(requestHeaders, ", "))
+			}
+
+			if c.cfg.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if c.cfg.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(c.cfg.MaxAge/time.Second)))
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// actual adds the CORS headers to an actual request.
+func (c *cors) actual(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+
+	// the response does not depend on the origin if all origins are allowed without credentials
+	if !c.allowAll || c.cfg.AllowCredentials {
+		header.Add("Vary", "Origin")
+	}
+
+	origin := r.Header.Get("Origin")
+	if !c.isOriginAllowed(origin) {
+		return
+	}
+
+	c.setAllowOrigin(header, origin)
+
+	if c.cfg.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if c.exposedHeaders != "" {
+		header.Set("Access-Control-Expose-Headers", c.exposedHeaders)
+	}
+}
+
+// setAllowOrigin sets the Access-Control-Allow-Origin header, * if all origins are allowed without credentials.
+func (c *cors) setAllowOrigin(header http.Header, origin string) {
+	if c.allowAll && !c.cfg.AllowCredentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	header.Set("Access-Control-Allow-Origin", origin)
+}
+
+// isOriginAllowed checks if the origin is allowed.
+func (c *cors) isOriginAllowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+
+	if c.allowAll {
+		return true
+	}
+
+	lower := strings.ToLower(origin)
+	if c.origins[lower] {
+		return true
+	}
+
+	for _, wildcard := range c.wildcards {
+		if len(lower) > len(wildcard[0])+len(wildcard[1]) && strings.HasPrefix(lower, wildcard[0]) && strings.HasSuffix(lower, wildcard[1]) {
+			return true
+		}
+	}
+
+	if c.cfg.AllowOriginFunc != nil {
+		return c.cfg.AllowOriginFunc(origin)
+	}
+
+	return false
+}
+
+// requestHeaders returns the canonical headers of the Access-Control-Request-Headers.
+// Returns false if a header is not allowed.
+func (c *cors) requestHeaders(r *http.Request) ([]string, bool) {
+	headers := []string{}
+
+	for _, value := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, header := range strings.Split(value, ",") {
+			header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+			if header == "" {
+				continue
+			}
+
+			if !c.allowAllHeader && !c.headers[header] {
+				return nil, false
+			}
+
+			headers = append(headers, header)
+		}
+	}
+
+	return headers, true
+}
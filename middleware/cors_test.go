@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fabysdev/fabyscore-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCORSTestServer(cfg CORSConfig) *server.Server {
+	srv := server.New()
+	srv.Use(CORS(cfg))
+	srv.GET("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user"))
+	})
+
+	return srv
+}
+
+func TestCORSPreflight(t *testing.T) {
+	srv := newCORSTestServer(CORSConfig{
+		AllowedOrigins:   []string{"https://example.com"},
+		AllowedMethods:   []string{"get", "put"},
+		AllowedHeaders:   []string{"content-type", "Authorization"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+
+	req := httptest.NewRequest("OPTIONS", "/users/1", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "content-type, authorization")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "", w.Body.String())
+	assert.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, PUT", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type, Authorization", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, w.Header().Values("Vary"))
+}
+
+func TestCORSPreflightRejected(t *testing.T) {
+	srv := newCORSTestServer(CORSConfig{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedHeaders: []string{"Content-Type"},
+	})
+
+	tests := []map[string]string{
+		{"Origin": "https://other.com", "Access-Control-Request-Method": "GET"},
+		{"Origin": "https://example.com", "Access-Control-Request-Method": "DELETE"},
+		{"Origin": "https://example.com", "Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Custom"},
+	}
+
+	for _, headers := range tests {
+		req := httptest.NewRequest("OPTIONS", "/users/1", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Methods"))
+	}
+}
+
+func TestCORSActual(t *testing.T) {
+	srv := newCORSTestServer(CORSConfig{
+		AllowedOrigins: []string{"https://*.example.com"},
+		ExposedHeaders: []string{"X-Total", "X-Page"},
+	})
+
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("Origin", "https://api.example.com")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user", w.Body.String())
+	assert.Equal(t, "https://api.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Total, X-Page", w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+
+	// not allowed origin
+	req = httptest.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("Origin", "https://example.com")
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	assert.Equal(t, "user", w.Body.String())
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+
+	// OPTIONS without preflight headers is answered by the automatic OPTIONS handler
+	req = httptest.NewRequest("OPTIONS", "/users/1", nil)
+	req.Header.Set("Origin", "https://api.example.com")
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, OPTIONS", w.Header().Get("Allow"))
+	assert.Equal(t, "https://api.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSAllowAll(t *testing.T) {
+	srv := newCORSTestServer(CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedHeaders: []string{"*"},
+	})
+
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("Origin", "https://any.com")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "", w.Header().Get("Vary"))
+
+	req = httptest.NewRequest("OPTIONS", "/users/1", nil)
+	req.Header.Set("Origin", "https://any.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "x-anything")
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Anything", w.Header().Get("Access-Control-Allow-Headers"))
+
+	// credentials reflect the origin
+	srv = newCORSTestServer(CORSConfig{
+		AllowedOrigins:   []string{"*"},
+		AllowCredentials: true,
+	})
+
+	req = httptest.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("Origin", "https://any.com")
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	assert.Equal(t, "https://any.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+}
+
+func TestCORSIsOriginAllowed(t *testing.T) {
+	c := newCORS(CORSConfig{
+		AllowedOrigins: []string{"https://Example.com", "https://*.example.org"},
+		AllowOriginFunc: func(origin string) bool {
+			return strings.HasSuffix(origin, ".test")
+		},
+	})
+
+	assert.True(t, c.isOriginAllowed("https://example.com"))
+	assert.True(t, c.isOriginAllowed("https://EXAMPLE.com"))
+	assert.True(t, c.isOriginAllowed("https://a.example.org"))
+	assert.True(t, c.isOriginAllowed("https://a.b.example.org"))
+	assert.True(t, c.isOriginAllowed("http://local.test"))
+	assert.False(t, c.isOriginAllowed(""))
+	assert.False(t, c.isOriginAllowed("https://example.org"))
+	assert.False(t, c.isOriginAllowed("https://.example.org"))
+	assert.False(t, c.isOriginAllowed("https://evilexample.org"))
+	assert.False(t, c.isOriginAllowed("http://a.example.org"))
+}
+
+func TestCORSDoesNotModifyConfig(t *testing.T) {
+	methods := []string{"get"}
+	newCORS(CORSConfig{AllowedMethods: methods})
+
+	assert.Equal(t, []string{"get"}, methods)
+}
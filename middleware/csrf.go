@@ -0,0 +1,377 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fabysdev/fabyscore-go/cache"
+	"github.com/fabysdev/fabyscore-go/server"
+)
+
+// CSRFContextKey is the csrf token context key.
+var CSRFContextKey = &server.ContextKey{"csrf"}
+
+// csrfErrorContextKey is the csrf failure context key.
+var csrfErrorContextKey = &server.ContextKey{"csrf-error"}
+
+var (
+	// ErrCSRFOrigin is the failure if the Origin or Referer header is not the same site or a trusted origin.
+	ErrCSRFOrigin = errors.New("csrf: origin not allowed")
+
+	// ErrCSRFTokenMissing is the failure if the request contains no token.
+	ErrCSRFTokenMissing = errors.New("csrf: token missing")
+
+	// ErrCSRFTokenInvalid is the failure if the request token does not match.
+	ErrCSRFTokenInvalid = errors.New("csrf: token invalid")
+)
+
+// csrfTokenLength is the length of the tokens in bytes.
+const csrfTokenLength = 32
+
+// CSRFMode is the type for the csrf token storage modes.
+type CSRFMode int
+
+const (
+	// DoubleSubmitCookie stores the token in a cookie, the request token must match the cookie.
+	DoubleSubmitCookie CSRFMode = iota
+
+	// SynchronizerToken stores the token per session in a cache.Cache, the cookie only contains the session id.
+	SynchronizerToken
+)
+
+// CSRFConfig is the configuration of the CSRF middleware.
+type CSRFConfig struct {
+	// Mode is the token storage mode. Defaults to DoubleSubmitCookie.
+	Mode CSRFMode
+
+	// Cache holds the synchronizer tokens. Defaults to a new cache with a cleanup every minute.
+	Cache *cache.Cache
+
+	// Session returns the session id of the request for synchronizer tokens (e.g. a session or user id).
+	// Defaults to a random session id stored in the cookie, also used if Session returns an empty string.
+	// Cookie session ids are only accepted if they were issued by the middleware and their token is still stored.
+	Session func(r *http.Request) string
+
+	// HeaderName is the request header containing the token. Defaults to X-CSRF-Token.
+	HeaderName string
+
+	// FieldName is the form field containing the token. Defaults to csrf_token.
+	FieldName string
+
+	// TrustedOrigins are additional allowed origins (e.g. https://app.example.com).
+	TrustedOrigins []string
+
+	// ErrorHandler handles the rejected requests, the reason is returned by CSRFFailure. Defaults to a 403 response.
+	ErrorHandler http.Handler
+
+	// MaxAge is the lifetime of the cookie and the synchronizer tokens. Defaults to 12 hours.
+	MaxAge time.Duration
+
+	// CookieName is the name of the cookie. Defaults to _csrf.
+	CookieName string
+
+	// CookiePath is the path of the cookie. Defaults to /.
+	CookiePath string
+
+	// CookieDomain is the domain of the cookie.
+	CookieDomain string
+
+	// CookieSecure sets the Secure flag of the cookie.
+	CookieSecure bool
+
+	// CookieSameSite is the SameSite attribute of the cookie. Defaults to http.SameSiteLaxMode.
+	CookieSameSite http.SameSite
+}
+
+// csrfToken is the csrf token of a request.
+type csrfToken struct {
+	token     []byte
+	fieldName string
+}
+
+// csrf is the CSRF middleware state.
+type csrf struct {
+	cfg CSRFConfig
+	mu  sync.Mutex
+}
+
+// CSRF protects the unsafe requests (all methods except GET, HEAD, OPTIONS and TRACE) against cross-site request forgery.
+// Unsafe requests must have a same-site or trusted Origin (or Referer if Origin is not set) and contain the token in the header or form field.
+// The token is returned by CSRFToken and CSRFTemplateField.
+func CSRF(cfg CSRFConfig) func(http.Handler) http.Handler {
+	if cfg.Mode == SynchronizerToken && cfg.Cache == nil {
+		cfg.Cache, _ = cache.NewWithCleanup(time.Minute)
+	}
+
+	if cfg.HeaderName == "" {
+		cfg.HeaderName = "X-CSRF-Token"
+	}
+
+	if cfg.FieldName == "" {
+		cfg.FieldName = "csrf_token"
+	}
+
+	if cfg.ErrorHandler == nil {
+		cfg.ErrorHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		})
+	}
+
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = 12 * time.Hour
+	}
+
+	if cfg.CookieName == "" {
+		cfg.CookieName = "_csrf"
+	}
+
+	if cfg.CookiePath == "" {
+		cfg.CookiePath = "/"
+	}
+
+	if cfg.CookieSameSite == 0 {
+		cfg.CookieSameSite = http.SameSiteLaxMode
+	}
+
+	c := &csrf{cfg: cfg}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := c.loadToken(w, r)
+			r = r.WithContext(context.WithValue(r.Context(), CSRFContextKey, &csrfToken{token: token, fieldName: c.cfg.FieldName}))
+
+			switch r.Method {
+			case "GET", "HEAD", "OPTIONS", "TRACE":
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err := c.verify(r, token); err != nil {
+				c.cfg.ErrorHandler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfErrorContextKey, err)))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// loadToken returns the token of the request, a new token is created and stored if it does not exist.
+func (c *csrf) loadToken(w http.ResponseWriter, r *http.Request) []byte {
+	if c.cfg.Mode == DoubleSubmitCookie {
+		if cookie, err := r.Cookie(c.cfg.CookieName); err == nil {
+			if token, err := base64.RawURLEncoding.DecodeString(cookie.Value); err == nil && len(token) == csrfTokenLength {
+				return token
+			}
+		}
+
+		token := randomBytes(csrfTokenLength)
+		c.setCookie(w, base64.RawURLEncoding.EncodeToString(token))
+
+		return token
+	}
+
+	session := ""
+	if c.cfg.Session != nil {
+		session = c.cfg.Session(r)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if session == "" {
+		// only session ids issued by the middleware are accepted, a session id chosen by the client is replaced
+		if cookie, err := r.Cookie(c.cfg.CookieName); err == nil && isCSRFSessionID(cookie.Value) {
+			if token, ok := c.storedToken("csrf:" + cookie.Value); ok {
+				return token
+			}
+		}
+
+		session = randomHex(csrfTokenLength)
+		c.setCookie(w, session)
+	} else if token, ok := c.storedToken("csrf:" + session); ok {
+		return token
+	}
+
+	token := randomBytes(csrfTokenLength)
+	c.cfg.Cache.Set("csrf:"+session, token, cache.Expire(c.cfg.MaxAge))
+
+	return token
+}
+
+// storedToken returns the token stored in the cache for the key.
+func (c *csrf) storedToken(key string) ([]byte, bool) {
+	if v, ok := c.cfg.Cache.Get(key); ok {
+		if token, ok := v.([]byte); ok {
+			return token, true
+		}
+	}
+
+	return nil, false
+}
+
+// isCSRFSessionID checks if the value has the format of the session ids created by the middleware (hex encoded random bytes).
+func isCSRFSessionID(value string) bool {
+	if len(value) != 2*csrfTokenLength {
+		return false
+	}
+
+	for i := 0; i < len(value); i++ {
+		if !('0' <= value[i] && value[i] <= '9' || 'a' <= value[i] && value[i] <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setCookie sets the csrf cookie.
+func (c *csrf) setCookie(w http.ResponseWriter, value string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.cfg.CookieName,
+		Value:    value,
+		Path:     c.cfg.CookiePath,
+		Domain:   c.cfg.CookieDomain,
+		MaxAge:   int(c.cfg.MaxAge.Seconds()),
+		Secure:   c.cfg.CookieSecure,
+		HttpOnly: true,
+		SameSite: c.cfg.CookieSameSite,
+	})
+}
+
+// verify checks the origin and the token of the request.
+func (c *csrf) verify(r *http.Request, token []byte) error {
+	if err := c.checkOrigin(r); err != nil {
+		return err
+	}
+
+	sent := r.Header.Get(c.cfg.HeaderName)
+	if sent == "" && isFormContentType(r.Header.Get("Content-Type")) {
+		sent = r.PostFormValue(c.cfg.FieldName)
+	}
+
+	if sent == "" {
+		return ErrCSRFTokenMissing
+	}
+
+	if subtle.ConstantTimeCompare(unmaskCSRFToken(sent), token) != 1 {
+		return ErrCSRFTokenInvalid
+	}
+
+	return nil
+}
+
+// checkOrigin checks the Origin header or the Referer header if Origin is not set.
+// The request origin is resolved by RealIP if it is used (e.g. behind a TLS terminating proxy).
+// Requests without both headers are only checked by the token.
+func (c *csrf) checkOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		referer := r.Header.Get("Referer")
+		if referer == "" {
+			return nil
+		}
+
+		u, err := url.Parse(referer)
+		if err != nil {
+			return ErrCSRFOrigin
+		}
+
+		origin = u.Scheme + "://" + u.Host
+	}
+
+	for _, trusted := range c.cfg.TrustedOrigins {
+		if strings.EqualFold(origin, trusted) {
+			return nil
+		}
+	}
+
+	if !strings.EqualFold(origin, ClientScheme(r)+"://"+ClientHost(r)) {
+		return ErrCSRFOrigin
+	}
+
+	return nil
+}
+
+// isFormContentType returns true for urlencoded and multipart form content types.
+func isFormContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data"
+}
+
+// maskCSRFToken returns the token xor'ed with a random pad, prefixed by the pad.
+// The masked token changes for every response (BREACH mitigation).
+func maskCSRFToken(token []byte) string {
+	pad := randomBytes(len(token))
+
+	masked := make([]byte, 2*len(token))
+	copy(masked, pad)
+	for i := range token {
+		masked[len(token)+i] = pad[i] ^ token[i]
+	}
+
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// unmaskCSRFToken returns the token of a masked token.
+// Unmasked tokens (e.g. the double submit cookie value) are returned as is.
+func unmaskCSRFToken(sent string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(sent)
+	if err != nil {
+		return nil
+	}
+
+	if len(b) != 2*csrfTokenLength {
+		return b
+	}
+
+	token := make([]byte, csrfTokenLength)
+	for i := range token {
+		token[i] = b[i] ^ b[csrfTokenLength+i]
+	}
+
+	return token
+}
+
+// CSRFToken returns a masked csrf token of the request for forms or the X-CSRF-Token header.
+// Returns an empty string if the CSRF middleware is not used.
+func CSRFToken(r *http.Request) string {
+	v, ok := r.Context().Value(CSRFContextKey).(*csrfToken)
+	if !ok {
+		return ""
+	}
+
+	return maskCSRFToken(v.token)
+}
+
+// CSRFTemplateField returns a hidden input containing the csrf token for html templates.
+// Returns an empty template.HTML if the CSRF middleware is not used.
+func CSRFTemplateField(r *http.Request) template.HTML {
+	v, ok := r.Context().Value(CSRFContextKey).(*csrfToken)
+	if !ok {
+		return ""
+	}
+
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`, template.HTMLEscapeString(v.fieldName), maskCSRFToken(v.token)))
+}
+
+// CSRFFailure returns the reason of the csrf failure in the ErrorHandler.
+// Returns nil if no failure was found.
+func CSRFFailure(ctx context.Context) error {
+	err, _ := ctx.Value(csrfErrorContextKey).(error)
+	return err
+}
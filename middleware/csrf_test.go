@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/fabysdev/fabyscore-go/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+var csrfHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(CSRFToken(r)))
+})
+
+func csrfRequest(handler http.Handler, method string, cookie *http.Cookie, setup func(r *http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "http://example.com/", nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	if setup != nil {
+		setup(req)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	return w
+}
+
+func csrfCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 {
+		return nil
+	}
+
+	return cookies[0]
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	handler := CSRF(CSRFConfig{})(csrfHandler)
+
+	w := csrfRequest(handler, "GET", nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	cookie := csrfCookie(w)
+	assert.Equal(t, "_csrf", cookie.Name)
+	assert.Equal(t, "/", cookie.Path)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	assert.Equal(t, 43200, cookie.MaxAge)
+
+	token := w.Body.String()
+	assert.NotEqual(t, "", token)
+
+	// the token is masked per response, the cookie is not set again
+	w = csrfRequest(handler, "GET", cookie, nil)
+	assert.NotEqual(t, token, w.Body.String())
+	assert.Nil(t, csrfCookie(w))
+
+	// header
+	w = csrfRequest(handler, "POST", cookie, func(r *http.Request) {
+		r.Header.Set("X-CSRF-Token", token)
+		r.Header.Set("Origin", "http://example.com")
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// unmasked cookie value in the header
+	w = csrfRequest(handler, "DELETE", cookie, func(r *http.Request) {
+		r.Header.Set("X-CSRF-Token", cookie.Value)
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// form field
+	w = csrfRequest(handler, "POST", cookie, func(r *http.Request) {
+		r.Body = httptest.NewRequest("POST", "/", strings.NewReader(url.Values{"csrf_token": {token}}.Encode())).Body
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Referer", "http://example.com/form")
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// token of another cookie
+	w = csrfRequest(handler, "POST", &http.Cookie{Name: "_csrf", Value: base64.RawURLEncoding.EncodeToString(make([]byte, 32))}, func(r *http.Request) {
+		r.Header.Set("X-CSRF-Token", token)
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// no cookie
+	w = csrfRequest(handler, "POST", nil, func(r *http.Request) {
+		r.Header.Set("X-CSRF-Token", token)
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestCSRFFailures(t *testing.T) {
+	var failure error
+	handler := CSRF(CSRFConfig{
+		TrustedOrigins: []string{"https://app.example.com"},
+		ErrorHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			failure = CSRFFailure(r.Context())
+			w.WriteHeader(http.StatusTeapot)
+		}),
+	})(csrfHandler)
+
+	w := csrfRequest(handler, "GET", nil, nil)
+	cookie := csrfCookie(w)
+	token := w.Body.String()
+
+	tests := []struct {
+		setup func(r *http.Request)
+		err   error
+	}{
+		{func(r *http.Request) {}, ErrCSRFTokenMissing},
+		{func(r *http.Request) { r.Header.Set("X-CSRF-Token", "invalid") }, ErrCSRFTokenInvalid},
+		{func(r *http.Request) { r.Header.Set("X-CSRF-Token", "%%%") }, ErrCSRFTokenInvalid},
+		{func(r *http.Request) { r.Header.Set("X-CSRF-Token", token); r.Header.Set("Origin", "http://evil.com") }, ErrCSRFOrigin},
+		{func(r *http.Request) { r.Header.Set("X-CSRF-Token", token); r.Header.Set("Origin", "null") }, ErrCSRFOrigin},
+		{func(r *http.Request) {
+			r.Header.Set("X-CSRF-Token", token)
+			r.Header.Set("Origin", "https://example.com")
+		}, ErrCSRFOrigin},
+		{func(r *http.Request) {
+			r.Header.Set("X-CSRF-Token", token)
+			r.Header.Set("Referer", "http://example.com.evil.com/")
+		}, ErrCSRFOrigin},
+		{func(r *http.Request) { r.Header.Set("X-CSRF-Token", token); r.Header.Set("Referer", "://") }, ErrCSRFOrigin},
+		{func(r *http.Request) {
+			r.Body = httptest.NewRequest("POST", "/", strings.NewReader("csrf_token="+token)).Body
+			r.Header.Set("Content-Type", "text/plain")
+		}, ErrCSRFTokenMissing},
+	}
+
+	for i, test := range tests {
+		failure = nil
+
+		w := csrfRequest(handler, "POST", cookie, test.setup)
+		assert.Equal(t, http.StatusTeapot, w.Code, i)
+		assert.Equal(t, test.err, failure, i)
+	}
+
+	// trusted origin
+	w = csrfRequest(handler, "PUT", cookie, func(r *http.Request) {
+		r.Header.Set("X-CSRF-Token", token)
+		r.Header.Set("Origin", "https://app.example.com")
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// https
+	w = csrfRequest(handler, "PATCH", cookie, func(r *http.Request) {
+		r.TLS = &tls.ConnectionState{}
+		r.Header.Set("X-CSRF-Token", token)
+		r.Header.Set("Origin", "https://example.com")
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// safe methods
+	for _, method := range []string{"GET", "HEAD", "OPTIONS", "TRACE"} {
+		w = csrfRequest(handler, method, nil, func(r *http.Request) { r.Header.Set("Origin", "http://evil.com") })
+		assert.Equal(t, http.StatusOK, w.Code, method)
+	}
+}
+
+func TestCSRFSynchronizerToken(t *testing.T) {
+	c := cache.New()
+	handler := CSRF(CSRFConfig{Mode: SynchronizerToken, Cache: c, CookieName: "session", HeaderName: "X-Token"})(csrfHandler)
+
+	w := csrfRequest(handler, "GET", nil, nil)
+	cookie := csrfCookie(w)
+	token := w.Body.String()
+
+	assert.Equal(t, "session", cookie.Name)
+	assert.Len(t, cookie.Value, 64)
+	assert.Equal(t, []string{"csrf:" + cookie.Value}, c.Keys())
+
+	w = csrfRequest(handler, "POST", cookie, func(r *http.Request) { r.Header.Set("X-Token", token) })
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the session id is not a token
+	w = csrfRequest(handler, "POST", cookie, func(r *http.Request) { r.Header.Set("X-Token", cookie.Value) })
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// another session
+	w = csrfRequest(handler, "POST", &http.Cookie{Name: "session", Value: "other"}, func(r *http.Request) { r.Header.Set("X-Token", token) })
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// session ids not issued by the middleware are replaced
+	fixated := strings.Repeat("a", 64)
+	for _, value := range []string{"attacker", fixated, strings.Repeat("A", 64)} {
+		w = csrfRequest(handler, "GET", &http.Cookie{Name: "session", Value: value}, nil)
+		assert.NotNil(t, csrfCookie(w), value)
+		assert.NotEqual(t, value, csrfCookie(w).Value, value)
+	}
+
+	assert.NotContains(t, c.Keys(), "csrf:"+fixated)
+	assert.NotContains(t, c.Keys(), "csrf:attacker")
+
+	// the issued session id is kept
+	w = csrfRequest(handler, "GET", cookie, nil)
+	assert.Nil(t, csrfCookie(w))
+
+	w = csrfRequest(handler, "POST", cookie, func(r *http.Request) { r.Header.Set("X-Token", token) })
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestCSRFSynchronizerTokenSession(t *testing.T) {
+	handler := CSRF(CSRFConfig{Mode: SynchronizerToken, Session: func(r *http.Request) string {
+		return r.Header.Get("X-User")
+	}})(csrfHandler)
+
+	w := csrfRequest(handler, "GET", nil, func(r *http.Request) { r.Header.Set("X-User", "user-1") })
+	assert.Nil(t, csrfCookie(w))
+	token := w.Body.String()
+
+	w = csrfRequest(handler, "POST", nil, func(r *http.Request) {
+		r.Header.Set("X-User", "user-1")
+		r.Header.Set("X-CSRF-Token", token)
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = csrfRequest(handler, "POST", nil, func(r *http.Request) {
+		r.Header.Set("X-User", "user-2")
+		r.Header.Set("X-CSRF-Token", token)
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestCSRFTemplateField(t *testing.T) {
+	var field string
+	handler := CSRF(CSRFConfig{FieldName: "token"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		field = string(CSRFTemplateField(r))
+	}))
+
+	csrfRequest(handler, "GET", nil, nil)
+	assert.Regexp(t, regexp.MustCompile(`^<input type="hidden" name="token" value="[A-Za-z0-9_-]{86}">$`), field)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	assert.Equal(t, "", string(CSRFTemplateField(req)))
+	assert.Equal(t, "", CSRFToken(req))
+	assert.Nil(t, CSRFFailure(req.Context()))
+}
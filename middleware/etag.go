@@ -0,0 +1,382 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fabysdev/fabyscore-go/server"
+)
+
+// defaultETagMaxSize is the default maximum buffered body size for the etag generation.
+const defaultETagMaxSize = 1 << 20
+
+// etagContextKey is the etag writer context key.
+var etagContextKey = &server.ContextKey{"etag"}
+
+// ETagValidatorFunc is the type for the functions returning the current validators of the requested resource.
+// The etag is quoted if it is not a quoted or weak entity tag, an empty etag and a zero time are returned for a non existing resource.
+type ETagValidatorFunc func(r *http.Request) (etag string, lastModified time.Time)
+
+// ETagOption is the type for the ETag options.
+type ETagOption func(*etagConfig)
+
+// ETagWeak generates weak etags (W/"...").
+func ETagWeak() ETagOption {
+	return func(c *etagConfig) {
+		c.weak = true
+	}
+}
+
+// ETagMaxSize sets the maximum buffered body size. Larger responses are streamed without an etag. Defaults to 1MB.
+func ETagMaxSize(size int) ETagOption {
+	return func(c *etagConfig) {
+		c.maxSize = size
+	}
+}
+
+// ETagValidator sets the validator of the resource.
+// The preconditions are checked before the handler is executed and the response is not buffered.
+// Required for the If-Match and If-Unmodified-Since preconditions of unsafe methods.
+func ETagValidator(fn ETagValidatorFunc) ETagOption {
+	return func(c *etagConfig) {
+		c.validator = fn
+	}
+}
+
+// etagConfig holds the ETag configuration.
+type etagConfig struct {
+	weak      bool
+	maxSize   int
+	validator ETagValidatorFunc
+}
+
+// ETag sets the ETag of GET and HEAD responses and answers If-None-Match and If-Modified-Since with 304.
+// Without a validator, 200 GET responses are buffered and hashed, unless the handler sets the ETag header itself or calls SkipETag.
+// HEAD responses have no body to hash, they only get the ETag of the validator or the handler.
+// The hashed ETag of an encoded response (e.g. by Compress) has the content coding as suffix.
+// Unsafe methods with If-Match or If-Unmodified-Since preconditions are rejected with 412 if the validator does not match.
+// Without a validator the preconditions of unsafe methods are not checked.
+func ETag(options ...ETagOption) func(http.Handler) http.Handler {
+	cfg := &etagConfig{
+		maxSize: defaultETagMaxSize,
+	}
+
+	for _, option := range options {
+		option(cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "GET" && r.Method != "HEAD" {
+				if cfg.validator != nil && (r.Header.Get("If-Match") != "" || r.Header.Get("If-Unmodified-Since") != "") {
+					etag, lastModified := cfg.validator(r)
+					if !checkIfMatch(r, quoteETag(etag), lastModified) {
+						http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+						return
+					}
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if cfg.validator != nil {
+				etag, lastModified := cfg.validator(r)
+
+				if etag = quoteETag(etag); etag != "" {
+					w.Header().Set("ETag", etag)
+				}
+
+				if !lastModified.IsZero() {
+					w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+				}
+
+				if checkNotModified(r, w.Header()) {
+					writeNotModified(w)
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ew := &etagWriter{
+				ResponseWriter: w,
+				cfg:            cfg,
+			}
+
+			next.ServeHTTP(ew, r.WithContext(context.WithValue(r.Context(), etagContextKey, ew)))
+			ew.finish(r)
+		})
+	}
+}
+
+// SkipETag streams the response of the request without an etag.
+func SkipETag(r *http.Request) {
+	if ew, ok := r.Context().Value(etagContextKey).(*etagWriter); ok {
+		ew.skip = true
+	}
+}
+
+// quoteETag returns the etag as quoted entity tag.
+func quoteETag(etag string) string {
+	if etag == "" || strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+
+	return `"` + etag + `"`
+}
+
+// parseETags returns the entity tags of an If-Match or If-None-Match header.
+func parseETags(header string) []string {
+	etags := []string{}
+
+	for header != "" {
+		header = strings.TrimLeft(header, " \t,")
+		if header == "" {
+			break
+		}
+
+		if header[0] == '*' {
+			etags = append(etags, "*")
+			header = header[1:]
+			continue
+		}
+
+		start := 0
+		if strings.HasPrefix(header, "W/") {
+			start = 2
+		}
+
+		if len(header) <= start || header[start] != '"' {
+			break
+		}
+
+		end := strings.IndexByte(header[start+1:], '"')
+		if end < 0 {
+			break
+		}
+
+		end += start + 2
+		etags = append(etags, header[:end])
+		header = header[end:]
+	}
+
+	return etags
+}
+
+// weakETagMatch compares the entity tags ignoring the weak indicator.
+func weakETagMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// checkIfMatch returns false if the If-Match or If-Unmodified-Since precondition fails.
+func checkIfMatch(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		for _, tag := range parseETags(ifMatch) {
+			if tag == "*" && etag != "" {
+				return true
+			}
+
+			if tag == etag && !strings.HasPrefix(etag, "W/") {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since"))
+	if err != nil || lastModified.IsZero() {
+		return true
+	}
+
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// checkNotModified returns true if the If-None-Match or If-Modified-Since condition matches the response validators.
+func checkNotModified(r *http.Request, header http.Header) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		etag := header.Get("ETag")
+
+		for _, tag := range parseETags(ifNoneMatch) {
+			if (tag == "*" && etag != "") || (etag != "" && weakETagMatch(tag, etag)) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+
+	return !lastModified.After(since)
+}
+
+// encodingSuffix returns the etag suffix of the content coding, the etag of an encoded representation differs from the identity representation.
+func encodingSuffix(encoding string) string {
+	encoding = strings.Map(func(r rune) rune {
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') || r == '-' {
+			return r
+		}
+
+		return -1
+	}, strings.ToLower(encoding))
+
+	if encoding == "" || encoding == "identity" {
+		return ""
+	}
+
+	return "-" + encoding
+}
+
+// writeNotModified sends a 304 response without the representation headers.
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+
+	if h.Get("ETag") != "" {
+		h.Del("Last-Modified")
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// etagWriter is a http.ResponseWriter buffering the body for the etag generation.
+type etagWriter struct {
+	http.ResponseWriter
+	cfg *etagConfig
+
+	status      int
+	buf         []byte
+	passthrough bool
+	skip        bool
+	hijacked    bool
+}
+
+// WriteHeader records the status code, the header is sent after the body is buffered.
+func (ew *etagWriter) WriteHeader(code int) {
+	if ew.status != 0 || ew.passthrough {
+		return
+	}
+
+	ew.status = code
+}
+
+// Write buffers the data, responses exceeding the maximum size and non 200 responses are streamed.
+func (ew *etagWriter) Write(b []byte) (int, error) {
+	if !ew.passthrough {
+		if !ew.skip && (ew.status == 0 || ew.status == http.StatusOK) && len(ew.buf)+len(b) <= ew.cfg.maxSize {
+			ew.buf = append(ew.buf, b...)
+			return len(b), nil
+		}
+
+		if err := ew.startPassthrough(); err != nil {
+			return 0, err
+		}
+	}
+
+	return ew.ResponseWriter.Write(b)
+}
+
+// Flush streams the response without an etag.
+func (ew *etagWriter) Flush() {
+	if !ew.passthrough {
+		ew.startPassthrough()
+	}
+
+	if f, ok := ew.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.
+// Returns an error if the wrapped ResponseWriter does not support it.
+func (ew *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := ew.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the ResponseWriter does not implement http.Hijacker")
+	}
+
+	conn, brw, err := h.Hijack()
+	if err == nil {
+		ew.hijacked = true
+	}
+
+	return conn, brw, err
+}
+
+// Unwrap returns the wrapped ResponseWriter.
+func (ew *etagWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// startPassthrough sends the header and the buffered data.
+func (ew *etagWriter) startPassthrough() error {
+	ew.passthrough = true
+
+	status := ew.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	ew.ResponseWriter.WriteHeader(status)
+
+	if len(ew.buf) > 0 {
+		if _, err := ew.ResponseWriter.Write(ew.buf); err != nil {
+			return err
+		}
+
+		ew.buf = nil
+	}
+
+	return nil
+}
+
+// finish sets the etag of buffered 200 responses and sends the response or 304.
+func (ew *etagWriter) finish(r *http.Request) {
+	if ew.hijacked || ew.passthrough {
+		return
+	}
+
+	if ew.skip || (ew.status != 0 && ew.status != http.StatusOK) {
+		ew.startPassthrough()
+		return
+	}
+
+	header := ew.Header()
+	if header.Get("ETag") == "" && r.Method != "HEAD" {
+		sum := sha256.Sum256(ew.buf)
+		etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + encodingSuffix(header.Get("Content-Encoding")) + `"`
+
+		if ew.cfg.weak {
+			etag = "W/" + etag
+		}
+
+		header.Set("ETag", etag)
+	}
+
+	if checkNotModified(r, header) {
+		writeNotModified(ew.ResponseWriter)
+		return
+	}
+
+	ew.startPassthrough()
+}
@@ -0,0 +1,218 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func etagRequest(handler http.Handler, method string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestETag(t *testing.T) {
+	handler := ETag()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello "))
+		w.Write([]byte("world"))
+	}))
+
+	w := etagRequest(handler, "GET", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "hello world", w.Body.String())
+
+	etag := w.Header().Get("ETag")
+	assert.Regexp(t, `^"[A-Za-z0-9_-]{22}"$`, etag)
+
+	// same body, same etag
+	assert.Equal(t, etag, etagRequest(handler, "GET", nil).Header().Get("ETag"))
+
+	for _, ifNoneMatch := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		w = etagRequest(handler, "GET", map[string]string{"If-None-Match": ifNoneMatch})
+		assert.Equal(t, http.StatusNotModified, w.Code, ifNoneMatch)
+		assert.Equal(t, "", w.Body.String())
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+		assert.Equal(t, "", w.Header().Get("Content-Type"))
+	}
+
+	w = etagRequest(handler, "HEAD", map[string]string{"If-None-Match": `"other"`})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// no body to hash
+	w = etagRequest(ETag()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})), "HEAD", map[string]string{"If-None-Match": `"47DEQpj8HBSa-_TImW-5JA"`})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Header().Get("ETag"))
+}
+
+func TestETagContentEncoding(t *testing.T) {
+	handler := ETag()(Compress(CompressMinSize(0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello world"))
+	})))
+
+	w := etagRequest(handler, "GET", map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Regexp(t, `^"[A-Za-z0-9_-]{22}-gzip"$`, w.Header().Get("ETag"))
+
+	w = etagRequest(handler, "GET", nil)
+	assert.Regexp(t, `^"[A-Za-z0-9_-]{22}"$`, w.Header().Get("ETag"))
+
+	assert.Equal(t, "", encodingSuffix("identity"))
+	assert.Equal(t, "-br", encodingSuffix(`"BR"`))
+}
+
+func TestETagWeak(t *testing.T) {
+	handler := ETag(ETagWeak())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+
+	w := etagRequest(handler, "GET", nil)
+	etag := w.Header().Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `W/"`))
+
+	w = etagRequest(handler, "GET", map[string]string{"If-None-Match": strings.TrimPrefix(etag, "W/")})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
+
+func TestETagHandlerValidators(t *testing.T) {
+	lastModified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	handler := ETag()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		w.Write([]byte("hello"))
+	}))
+
+	w := etagRequest(handler, "GET", map[string]string{"If-None-Match": `"v1"`})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, `"v1"`, w.Header().Get("ETag"))
+	assert.Equal(t, "", w.Header().Get("Last-Modified"))
+
+	w = etagRequest(handler, "GET", map[string]string{"If-None-Match": `"v0"`, "If-Modified-Since": lastModified.Format(http.TimeFormat)})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = etagRequest(handler, "GET", map[string]string{"If-Modified-Since": lastModified.Format(http.TimeFormat)})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = etagRequest(handler, "GET", map[string]string{"If-Modified-Since": lastModified.Add(-time.Second).Format(http.TimeFormat)})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = etagRequest(handler, "GET", map[string]string{"If-Modified-Since": "invalid"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestETagStreamed(t *testing.T) {
+	tests := map[string]http.HandlerFunc{
+		"status": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("created"))
+		},
+		"max size": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("12345"))
+			w.Write([]byte("678901"))
+		},
+		"flush": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("data"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("more"))
+		},
+		"skip": func(w http.ResponseWriter, r *http.Request) {
+			SkipETag(r)
+			w.Write([]byte("skipped"))
+		},
+		"skip after write": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("skipped"))
+			SkipETag(r)
+		},
+		"error": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "error", http.StatusInternalServerError)
+		},
+	}
+
+	for name, fn := range tests {
+		w := etagRequest(ETag(ETagMaxSize(10))(fn), "GET", map[string]string{"If-None-Match": "*"})
+		assert.NotEqual(t, http.StatusNotModified, w.Code, name)
+		assert.NotEqual(t, "", w.Body.String(), name)
+		assert.Equal(t, "", w.Header().Get("ETag"), name)
+	}
+
+	w := etagRequest(ETag()(tests["flush"]), "GET", nil)
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "datamore", w.Body.String())
+}
+
+func TestETagValidator(t *testing.T) {
+	lastModified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	exists := true
+	calls := 0
+
+	handler := ETag(ETagValidator(func(r *http.Request) (string, time.Time) {
+		if !exists {
+			return "", time.Time{}
+		}
+
+		return "v2", lastModified
+	}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("ok"))
+	}))
+
+	w := etagRequest(handler, "GET", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"v2"`, w.Header().Get("ETag"))
+	assert.Equal(t, "Thu, 02 Jan 2020 03:04:05 GMT", w.Header().Get("Last-Modified"))
+
+	// the handler is not executed for 304
+	w = etagRequest(handler, "GET", map[string]string{"If-None-Match": `"v2"`})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, 1, calls)
+
+	tests := []struct {
+		headers map[string]string
+		status  int
+	}{
+		{map[string]string{"If-Match": `"v2"`}, http.StatusOK},
+		{map[string]string{"If-Match": `"v1", "v2"`}, http.StatusOK},
+		{map[string]string{"If-Match": "*"}, http.StatusOK},
+		{map[string]string{"If-Match": `"v1"`}, http.StatusPreconditionFailed},
+		{map[string]string{"If-Match": `W/"v2"`}, http.StatusPreconditionFailed},
+		{map[string]string{"If-Unmodified-Since": lastModified.Format(http.TimeFormat)}, http.StatusOK},
+		{map[string]string{"If-Unmodified-Since": lastModified.Add(-time.Second).Format(http.TimeFormat)}, http.StatusPreconditionFailed},
+		{map[string]string{"If-Match": `"v2"`, "If-Unmodified-Since": lastModified.Add(-time.Second).Format(http.TimeFormat)}, http.StatusOK},
+		{map[string]string{}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		w = etagRequest(handler, "PUT", test.headers)
+		assert.Equal(t, test.status, w.Code, test.headers)
+	}
+
+	// non existing resource
+	exists = false
+
+	w = etagRequest(handler, "PATCH", map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = etagRequest(handler, "GET", map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Header().Get("ETag"))
+}
+
+func TestParseETags(t *testing.T) {
+	assert.Equal(t, []string{`"a"`, `W/"b"`, "*", `"c,d"`}, parseETags(` "a",W/"b" , *, "c,d"`))
+	assert.Equal(t, []string{`"a"`}, parseETags(`"a", invalid`))
+	assert.Equal(t, []string{}, parseETags(`"unterminated`))
+	assert.Equal(t, []string{}, parseETags(`W/`))
+}
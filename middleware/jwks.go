@@ -0,0 +1,284 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// minRSAKeyBits is the minimum size of the RS256 keys.
+const minRSAKeyBits = 2048
+
+// JWTKey is a verification key of the JWT middleware.
+// Key is a []byte for HS256, *rsa.PublicKey (at least 2048 bits) for RS256, *ecdsa.PublicKey (P-256) for ES256 and ed25519.PublicKey for EdDSA.
+type JWTKey struct {
+	ID        string
+	Algorithm string
+	Key       interface{}
+}
+
+// JWTKeySet provides the verification keys of the JWT middleware.
+type JWTKeySet interface {
+	Keys() []JWTKey
+}
+
+// StaticJWTKeySet is a fixed JWTKeySet.
+type StaticJWTKeySet []JWTKey
+
+// Keys returns the keys.
+func (s StaticJWTKeySet) Keys() []JWTKey {
+	return s
+}
+
+// JWKSFile is a JWTKeySet loading the keys from a local JWKS (RFC 7517) file and reloading them if the file changes.
+// The file is only reloaded by Reload, ReloadModified or the go routine started by Watch.
+// Create a new instance by using NewJWKSFile().
+type JWKSFile struct {
+	path string
+
+	mu      sync.RWMutex
+	keys    []JWTKey
+	modTime time.Time
+}
+
+// NewJWKSFile returns a JWKSFile for the given file.
+// Call Watch to reload the keys if the file changes.
+// Returns an error if the file can not be loaded.
+func NewJWKSFile(path string) (*JWKSFile, error) {
+	f := &JWKSFile{path: path}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Keys returns the loaded keys.
+func (f *JWKSFile) Keys() []JWTKey {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.keys
+}
+
+// Reload loads the keys.
+// The previously loaded keys are still used if the file fails to load.
+func (f *JWKSFile) Reload() error {
+	return f.reload(true)
+}
+
+// ReloadModified loads the keys if the file modification time changed.
+// The previously loaded keys are still used if the file fails to load.
+func (f *JWKSFile) ReloadModified() error {
+	return f.reload(false)
+}
+
+// Watch starts a go routine calling ReloadModified in the given interval.
+// Reload errors are passed to onError if set. The returned channel is used to stop the watcher.
+func (f *JWKSFile) Watch(interval time.Duration, onError func(error)) chan bool {
+	stop := make(chan bool)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ticker.C:
+				if err := f.ReloadModified(); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-stop:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return stop
+}
+
+// reload loads the keys, only if the file was modified if force is false.
+func (f *JWKSFile) reload(force bool) error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.mu.RLock()
+	modified := !info.ModTime().Equal(f.modTime)
+	f.mu.RUnlock()
+
+	if !force && !modified {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", f.path, err)
+	}
+
+	f.mu.Lock()
+	f.keys = keys
+	f.modTime = info.ModTime()
+	f.mu.Unlock()
+
+	return nil
+}
+
+// jwk is a json web key.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// jwkAlgorithms maps the supported key types (with the curve for EC and OKP keys) to their signing algorithm.
+var jwkAlgorithms = map[string]string{
+	"RSA":         "RS256",
+	"EC P-256":    "ES256",
+	"OKP Ed25519": "EdDSA",
+	"oct":         "HS256",
+}
+
+// ParseJWKS returns the keys of the JWKS json.
+// Supports RSA (at least 2048 bits), EC (P-256), OKP (Ed25519) and oct keys.
+// Keys of other types, curves, algorithms or sizes and keys with another use than sig are skipped.
+// Returns an error for malformed supported keys or if the set has no supported key.
+func ParseJWKS(data []byte) ([]JWTKey, error) {
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := []JWTKey{}
+	for i, k := range set.Keys {
+		if (k.Use != "" && k.Use != "sig") || k.algorithm() == "" {
+			continue
+		}
+
+		key, err := k.parse()
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %v", i, err)
+		}
+
+		if pub, ok := key.Key.(*rsa.PublicKey); ok && pub.N.BitLen() < minRSAKeyBits {
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no supported signing key")
+	}
+
+	return keys, nil
+}
+
+// algorithm returns the signing algorithm of the json web key or an empty string if the key is not supported.
+func (k jwk) algorithm() string {
+	kty := k.Kty
+	if kty == "EC" || kty == "OKP" {
+		kty += " " + k.Crv
+	}
+
+	algorithm := jwkAlgorithms[kty]
+	if k.Alg != "" && k.Alg != algorithm {
+		return ""
+	}
+
+	return algorithm
+}
+
+// parse returns the JWTKey of the json web key.
+func (k jwk) parse() (JWTKey, error) {
+	key := JWTKey{ID: k.Kid, Algorithm: k.algorithm()}
+	if key.Algorithm == "" {
+		return key, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return key, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return key, err
+		}
+
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return key, errors.New("invalid rsa exponent")
+		}
+
+		key.Key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return key, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return key, err
+		}
+
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return key, errors.New("invalid ec point")
+		}
+
+		key.Key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return key, errors.New("invalid ed25519 key")
+		}
+
+		key.Key = ed25519.PublicKey(x)
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return key, errors.New("invalid oct key")
+		}
+
+		key.Key = secret
+	}
+
+	return key, nil
+}
+
+// decodeBigInt decodes a base64url encoded big-endian integer.
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
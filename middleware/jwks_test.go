@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testJWKS = `{"keys": [
+	{"kty": "RSA", "kid": "rsa", "use": "sig", "n": "sXchDaQebHnPiGvyDOAT4saGEUetSyo9MKLOoWFsueri23bOdgWp4Dy1WlUzewbgBHod5pcM9H95GQRV3JDXboIRROSBigeC5yjU1hGzHHyXss8UDprecbAYxknTcQkhslANGRUZmdTOQ5qTRsLAt6BTYuyvVRdhS8exSZEy_c4gs_7svlJJQ4H9_NxsiIoLwAEk7-Q3UXERGYw_75IDrGA84-lA_-Ct4eTlXHBIY2EaV7t7LjJaynVJCpkv4LKjTTAumiGUIuQhrNhZLuF_RJLqHpM2kgWFLU7-VTdL1VbC2tejvcI2BlMkEpk1BzBZI0KQB0GaDWFLN-aEAw3vRw", "e": "AQAB"},
+	{"kty": "EC", "kid": "ec", "crv": "P-256", "x": "f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU", "y": "x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0"},
+	{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+	{"kty": "oct", "kid": "hs", "alg": "HS256", "k": "c2VjcmV0"},
+	{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"}
+]}`
+
+func TestParseJWKS(t *testing.T) {
+	keys, err := ParseJWKS([]byte(testJWKS))
+	assert.Nil(t, err)
+	assert.Len(t, keys, 4)
+
+	assert.Equal(t, "rsa", keys[0].ID)
+	assert.Equal(t, "RS256", keys[0].Algorithm)
+	assert.Equal(t, 65537, keys[0].Key.(*rsa.PublicKey).E)
+
+	assert.Equal(t, "ES256", keys[1].Algorithm)
+	assert.IsType(t, &ecdsa.PublicKey{}, keys[1].Key)
+
+	assert.Equal(t, "EdDSA", keys[2].Algorithm)
+	assert.Len(t, keys[2].Key.(ed25519.PublicKey), ed25519.PublicKeySize)
+
+	assert.Equal(t, "HS256", keys[3].Algorithm)
+	assert.Equal(t, []byte("secret"), keys[3].Key)
+}
+
+func TestParseJWKSInvalid(t *testing.T) {
+	tests := []string{
+		`invalid`,
+		`{"keys": []}`,
+		`{"keys": [{"kty": "unknown"}]}`,
+		`{"keys": [{"kty": "RSA", "n": "", "e": "AQAB"}]}`,
+		`{"keys": [{"kty": "EC", "crv": "P-384", "x": "AQAB", "y": "AQAB"}]}`,
+		`{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQAB", "y": "AQAB"}]}`,
+		`{"keys": [{"kty": "OKP", "crv": "Ed25519", "x": "AQAB"}]}`,
+		`{"keys": [{"kty": "oct", "k": ""}]}`,
+		`{"keys": [{"kty": "oct", "alg": "HS512", "k": "c2VjcmV0"}]}`,
+		`{"keys": [{"kty": "oct", "k": "c2VjcmV0"}, {"kty": "RSA", "n": "", "e": "AQAB"}]}`,
+	}
+
+	for _, data := range tests {
+		_, err := ParseJWKS([]byte(data))
+		assert.NotNil(t, err, data)
+	}
+}
+
+func TestParseJWKSSkipsUnsupportedKeys(t *testing.T) {
+	keys, err := ParseJWKS([]byte(`{"keys": [
+		{"kty": "RSA", "kid": "rs384", "alg": "RS384", "n": "AQAB", "e": "AQAB"},
+		{"kty": "EC", "kid": "p384", "crv": "P-384", "x": "AQAB", "y": "AQAB"},
+		{"kty": "OKP", "kid": "x25519", "crv": "X25519", "x": "AQAB"},
+		{"kty": "unknown", "kid": "unknown"},
+		{"kty": "oct", "kid": "hs", "k": "c2VjcmV0"}
+	]}`))
+	assert.Nil(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, "hs", keys[0].ID)
+}
+
+func TestParseJWKSSkipsSmallRSAKeys(t *testing.T) {
+	small, _ := rsa.GenerateKey(rand.Reader, 1024)
+	n := base64.RawURLEncoding.EncodeToString(small.N.Bytes())
+
+	keys, err := ParseJWKS([]byte(`{"keys": [
+		{"kty": "RSA", "kid": "small", "n": "` + n + `", "e": "AQAB"},
+		{"kty": "oct", "kid": "hs", "k": "c2VjcmV0"}
+	]}`))
+	assert.Nil(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, "hs", keys[0].ID)
+}
+
+func TestJWKSFileReload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "jwks")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "jwks.json")
+	ioutil.WriteFile(path, []byte(`{"keys": [{"kty": "oct", "kid": "one", "k": "c2VjcmV0"}]}`), 0600)
+
+	f, err := NewJWKSFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "one", f.Keys()[0].ID)
+
+	// unchanged modification time
+	ioutil.WriteFile(path, []byte(`{"keys": [{"kty": "oct", "kid": "two", "k": "c2VjcmV0"}]}`), 0600)
+	modTime := time.Now().Add(-time.Hour)
+	os.Chtimes(path, modTime, modTime)
+	assert.Nil(t, f.Reload())
+	assert.Equal(t, "two", f.Keys()[0].ID)
+
+	ioutil.WriteFile(path, []byte(`{"keys": [{"kty": "oct", "kid": "three", "k": "c2VjcmV0"}]}`), 0600)
+	os.Chtimes(path, modTime, modTime)
+	assert.Nil(t, f.ReloadModified())
+	assert.Equal(t, "two", f.Keys()[0].ID)
+
+	// changed modification time
+	os.Chtimes(path, modTime.Add(time.Minute), modTime.Add(time.Minute))
+	assert.Nil(t, f.ReloadModified())
+	assert.Equal(t, "three", f.Keys()[0].ID)
+
+	// invalid file keeps the keys
+	ioutil.WriteFile(path, []byte(`invalid`), 0600)
+	assert.NotNil(t, f.Reload())
+	assert.Equal(t, "three", f.Keys()[0].ID)
+
+	// watcher
+	ioutil.WriteFile(path, []byte(`{"keys": [{"kty": "oct", "kid": "four", "k": "c2VjcmV0"}]}`), 0600)
+	os.Chtimes(path, modTime.Add(2*time.Minute), modTime.Add(2*time.Minute))
+
+	stop := f.Watch(10*time.Millisecond, nil)
+	defer close(stop)
+
+	assert.Eventually(t, func() bool { return f.Keys()[0].ID == "four" }, time.Second, 10*time.Millisecond)
+
+	_, err = NewJWKSFile(filepath.Join(dir, "missing.json"))
+	assert.NotNil(t, err)
+}
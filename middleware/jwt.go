@@ -0,0 +1,376 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fabysdev/fabyscore-go/server"
+)
+
+// JWTClaimsContextKey is the jwt claims context key.
+var JWTClaimsContextKey = &server.ContextKey{"jwt-claims"}
+
+// JWTConfig is the configuration of the JWT middleware.
+type JWTConfig struct {
+	// Keys are the verification keys (e.g. StaticJWTKeySet or a JWKSFile).
+	Keys JWTKeySet
+
+	// Issuer is the required iss claim, not checked if empty.
+	Issuer string
+
+	// Audience is the required value of the aud claim, not checked if empty.
+	Audience string
+
+	// Scopes are the required values of the space separated scope claim.
+	Scopes []string
+
+	// ClockSkew is the tolerance for the exp and nbf claims.
+	ClockSkew time.Duration
+
+	// Realm is the realm of the WWW-Authenticate challenge.
+	Realm string
+}
+
+// JWTClaims are the claims of a verified token.
+type JWTClaims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	ID        string
+	Scopes    []string
+
+	// Raw contains all claims (e.g. for custom claims).
+	Raw map[string]interface{}
+}
+
+// jwtError is a token rejection with the RFC 6750 error code.
+type jwtError struct {
+	status      int
+	code        string
+	description string
+}
+
+// Error returns the description.
+func (e *jwtError) Error() string {
+	return e.description
+}
+
+// invalidToken returns an invalid_token jwtError.
+func invalidToken(description string) *jwtError {
+	return &jwtError{status: http.StatusUnauthorized, code: "invalid_token", description: description}
+}
+
+// JWT authenticates the requests with a bearer token signed with HS256, RS256, ES256 or EdDSA.
+// Verifies the signature and the exp, nbf, iss, aud and scope claims. The claims and the sub claim as principal are added into the request context.
+// Rejections use the RFC 6750 WWW-Authenticate errors: 401 without error for a missing token, 401 invalid_token and 403 insufficient_scope.
+// Panics if Keys is nil.
+func JWT(cfg JWTConfig) func(http.Handler) http.Handler {
+	if cfg.Keys == nil {
+		panic("JWT requires a key set")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				unauthorized(w, cfg.challenge(nil))
+				return
+			}
+
+			claims, err := cfg.verify(token, timeNow())
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", cfg.challenge(err))
+				http.Error(w, http.StatusText(err.status), err.status)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), JWTClaimsContextKey, claims)
+			if claims.Subject != "" {
+				ctx = context.WithValue(ctx, PrincipalContextKey, claims.Subject)
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetJWTClaims returns the verified jwt claims from the given context.
+// Returns false if no claims were found.
+func GetJWTClaims(ctx context.Context) (*JWTClaims, bool) {
+	claims, ok := ctx.Value(JWTClaimsContextKey).(*JWTClaims)
+	return claims, ok
+}
+
+// challenge returns the WWW-Authenticate value for the error, without error attributes if err is nil.
+func (cfg *JWTConfig) challenge(err *jwtError) string {
+	params := []string{}
+	if cfg.Realm != "" {
+		params = append(params, fmt.Sprintf("realm=%q", cfg.Realm))
+	}
+
+	if err != nil {
+		params = append(params, fmt.Sprintf("error=%q", err.code), fmt.Sprintf("error_description=%q", err.description))
+
+		if err.code == "insufficient_scope" {
+			params = append(params, fmt.Sprintf("scope=%q", strings.Join(cfg.Scopes, " ")))
+		}
+	}
+
+	if len(params) == 0 {
+		return "Bearer"
+	}
+
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+// verify verifies the token and returns the claims.
+func (cfg *JWTConfig) verify(token string, now time.Time) (*JWTClaims, *jwtError) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("malformed token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, invalidToken("malformed token")
+	}
+
+	header := struct {
+		Alg  string          `json:"alg"`
+		Kid  string          `json:"kid"`
+		Crit json.RawMessage `json:"crit"`
+	}{}
+
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, invalidToken("malformed token")
+	}
+
+	// no header extensions are supported, tokens with critical extensions must be rejected (RFC 7515 4.1.11)
+	if header.Crit != nil {
+		return nil, invalidToken("unsupported critical header")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("malformed token")
+	}
+
+	if !cfg.verifySignature(header.Alg, header.Kid, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, invalidToken("invalid signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, invalidToken("malformed token")
+	}
+
+	claims, err := parseJWTClaims(payload)
+	if err != nil {
+		return nil, invalidToken(err.Error())
+	}
+
+	if !claims.ExpiresAt.IsZero() && now.After(claims.ExpiresAt.Add(cfg.ClockSkew)) {
+		return nil, invalidToken("token expired")
+	}
+
+	if !claims.NotBefore.IsZero() && now.Add(cfg.ClockSkew).Before(claims.NotBefore) {
+		return nil, invalidToken("token not valid yet")
+	}
+
+	if cfg.Issuer != "" && claims.Issuer != cfg.Issuer {
+		return nil, invalidToken("invalid issuer")
+	}
+
+	if cfg.Audience != "" && !containsParam(claims.Audience, cfg.Audience) {
+		return nil, invalidToken("invalid audience")
+	}
+
+	for _, scope := range cfg.Scopes {
+		if !containsParam(claims.Scopes, scope) {
+			return nil, &jwtError{status: http.StatusForbidden, code: "insufficient_scope", description: "insufficient scope"}
+		}
+	}
+
+	return claims, nil
+}
+
+// verifySignature checks the signature with the keys matching the algorithm and key id.
+// The algorithm of the key must match the token algorithm.
+func (cfg *JWTConfig) verifySignature(alg, kid string, signed, signature []byte) bool {
+	for _, key := range cfg.Keys.Keys() {
+		if key.Algorithm != alg || (kid != "" && key.ID != "" && key.ID != kid) {
+			continue
+		}
+
+		if verifyJWTSignature(key, signed, signature) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifyJWTSignature verifies the signature with the key.
+func verifyJWTSignature(key JWTKey, signed, signature []byte) bool {
+	switch key.Algorithm {
+	case "HS256":
+		secret, ok := key.Key.([]byte)
+		if !ok {
+			return false
+		}
+
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+
+		return hmac.Equal(signature, mac.Sum(nil))
+	case "RS256":
+		pub, ok := key.Key.(*rsa.PublicKey)
+		if !ok || pub.N.BitLen() < minRSAKeyBits {
+			return false
+		}
+
+		hash := sha256.Sum256(signed)
+
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], signature) == nil
+	case "ES256":
+		pub, ok := key.Key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() || len(signature) != 64 {
+			return false
+		}
+
+		hash := sha256.Sum256(signed)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+
+		return ecdsa.Verify(pub, hash[:], r, s)
+	case "EdDSA":
+		pub, ok := key.Key.(ed25519.PublicKey)
+		if !ok || len(pub) != ed25519.PublicKeySize {
+			return false
+		}
+
+		return ed25519.Verify(pub, signed, signature)
+	}
+
+	return false
+}
+
+// parseJWTClaims parses the registered claims of the payload.
+func parseJWTClaims(payload []byte) (*JWTClaims, error) {
+	raw := map[string]interface{}{}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, errors.New("malformed claims")
+	}
+
+	claims := &JWTClaims{Raw: raw}
+
+	var err error
+	if claims.Issuer, err = stringClaim(raw, "iss"); err != nil {
+		return nil, err
+	}
+
+	if claims.Subject, err = stringClaim(raw, "sub"); err != nil {
+		return nil, err
+	}
+
+	if claims.ID, err = stringClaim(raw, "jti"); err != nil {
+		return nil, err
+	}
+
+	if claims.ExpiresAt, err = dateClaim(raw, "exp"); err != nil {
+		return nil, err
+	}
+
+	if claims.NotBefore, err = dateClaim(raw, "nbf"); err != nil {
+		return nil, err
+	}
+
+	if claims.IssuedAt, err = dateClaim(raw, "iat"); err != nil {
+		return nil, err
+	}
+
+	switch aud := raw["aud"].(type) {
+	case nil:
+	case string:
+		claims.Audience = []string{aud}
+	case []interface{}:
+		for _, v := range aud {
+			s, ok := v.(string)
+			if !ok {
+				return nil, errors.New("invalid aud claim")
+			}
+
+			claims.Audience = append(claims.Audience, s)
+		}
+	default:
+		return nil, errors.New("invalid aud claim")
+	}
+
+	scope, err := stringClaim(raw, "scope")
+	if err != nil {
+		return nil, err
+	}
+
+	claims.Scopes = strings.Fields(scope)
+
+	return claims, nil
+}
+
+// stringClaim returns the string claim, an empty string if the claim does not exist.
+func stringClaim(raw map[string]interface{}, name string) (string, error) {
+	v, ok := raw[name]
+	if !ok {
+		return "", nil
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid %s claim", name)
+	}
+
+	return s, nil
+}
+
+// dateClaim returns the NumericDate claim, a zero time if the claim does not exist.
+func dateClaim(raw map[string]interface{}, name string) (time.Time, error) {
+	v, ok := raw[name]
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid %s claim", name)
+	}
+
+	f, err := n.Float64()
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return time.Time{}, fmt.Errorf("invalid %s claim", name)
+	}
+
+	sec, frac := math.Modf(f)
+
+	return time.Unix(int64(sec), int64(frac*1e9)), nil
+}
@@ -0,0 +1,264 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var jwtTestNow = time.Unix(1600000000, 0)
+
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	hash := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RS256":
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, hash[:])
+		assert.Nil(t, err)
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), hash[:])
+		assert.Nil(t, err)
+
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	case "EdDSA":
+		signature = ed25519.Sign(key.(ed25519.PrivateKey), []byte(signed))
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func jwtRequest(handler http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestJWTAlgorithms(t *testing.T) {
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	timeNow = func() time.Time { return jwtTestNow }
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	secret := []byte("secret")
+
+	keys := StaticJWTKeySet{
+		{ID: "hs", Algorithm: "HS256", Key: secret},
+		{ID: "rs", Algorithm: "RS256", Key: &rsaKey.PublicKey},
+		{ID: "es", Algorithm: "ES256", Key: &ecKey.PublicKey},
+		{Algorithm: "EdDSA", Key: edPublic},
+	}
+
+	handler := JWT(JWTConfig{Keys: keys})(principalHandler)
+	claims := map[string]interface{}{"sub": "user-1", "exp": jwtTestNow.Unix() + 60}
+
+	tokens := map[string]string{
+		"HS256": signJWT(t, "HS256", "hs", secret, claims),
+		"RS256": signJWT(t, "RS256", "rs", rsaKey, claims),
+		"ES256": signJWT(t, "ES256", "es", ecKey, claims),
+		"EdDSA": signJWT(t, "EdDSA", "", edPrivate, claims),
+	}
+
+	for alg, token := range tokens {
+		w := jwtRequest(handler, token)
+		assert.Equal(t, http.StatusOK, w.Code, alg)
+		assert.Equal(t, "user-1", w.Body.String(), alg)
+	}
+
+	// wrong key
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	w := jwtRequest(handler, signJWT(t, "ES256", "es", otherKey, claims))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer error=\"invalid_token\", error_description=\"invalid signature\"", w.Header().Get("WWW-Authenticate"))
+
+	// kid of another key
+	w = jwtRequest(handler, signJWT(t, "HS256", "rs", secret, claims))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// algorithm confusion: the rsa public key used as hmac secret
+	w = jwtRequest(handler, signJWT(t, "HS256", "rs", []byte("rs"), claims))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// rsa keys under 2048 bits
+	smallKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	handler = JWT(JWTConfig{Keys: StaticJWTKeySet{{Algorithm: "RS256", Key: &smallKey.PublicKey}}})(principalHandler)
+	w = jwtRequest(handler, signJWT(t, "RS256", "", smallKey, claims))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestJWTCriticalHeader(t *testing.T) {
+	secret := []byte("secret")
+	handler := JWT(JWTConfig{Keys: StaticJWTKeySet{{Algorithm: "HS256", Key: secret}}})(principalHandler)
+
+	signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","crit":["b64"],"b64":false}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1"}`))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+
+	w := jwtRequest(handler, signed+"."+base64.RawURLEncoding.EncodeToString(mac.Sum(nil)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer error=\"invalid_token\", error_description=\"unsupported critical header\"", w.Header().Get("WWW-Authenticate"))
+}
+
+func TestJWTRejected(t *testing.T) {
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	timeNow = func() time.Time { return jwtTestNow }
+
+	secret := []byte("secret")
+	handler := JWT(JWTConfig{
+		Keys:      StaticJWTKeySet{{Algorithm: "HS256", Key: secret}},
+		Issuer:    "https://issuer.example",
+		Audience:  "api",
+		ClockSkew: 30 * time.Second,
+		Realm:     "api",
+	})(principalHandler)
+
+	valid := map[string]interface{}{"iss": "https://issuer.example", "aud": []string{"other", "api"}}
+
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{}
+		for k, v := range valid {
+			c[k] = v
+		}
+
+		for k, v := range extra {
+			c[k] = v
+		}
+
+		return c
+	}
+
+	assert.Equal(t, http.StatusOK, jwtRequest(handler, signJWT(t, "HS256", "", secret, valid)).Code)
+	assert.Equal(t, http.StatusOK, jwtRequest(handler, signJWT(t, "HS256", "", secret, claims(map[string]interface{}{"exp": jwtTestNow.Unix() - 20, "aud": "api"}))).Code)
+	assert.Equal(t, http.StatusOK, jwtRequest(handler, signJWT(t, "HS256", "", secret, claims(map[string]interface{}{"nbf": jwtTestNow.Unix() + 20}))).Code)
+
+	tests := map[string]string{
+		"a.b":                              "malformed token",
+		"a.b.c":                            "malformed token",
+		signJWT(t, "none", "", nil, valid): "invalid signature",
+		signJWT(t, "HS256", "", secret, claims(map[string]interface{}{"exp": jwtTestNow.Unix() - 31})):  "token expired",
+		signJWT(t, "HS256", "", secret, claims(map[string]interface{}{"nbf": jwtTestNow.Unix() + 31})):  "token not valid yet",
+		signJWT(t, "HS256", "", secret, claims(map[string]interface{}{"iss": "https://other.example"})): "invalid issuer",
+		signJWT(t, "HS256", "", secret, claims(map[string]interface{}{"aud": "other"})):                 "invalid audience",
+		signJWT(t, "HS256", "", secret, claims(map[string]interface{}{"aud": 1})):                       "invalid aud claim",
+		signJWT(t, "HS256", "", secret, claims(map[string]interface{}{"exp": "tomorrow"})):              "invalid exp claim",
+		signJWT(t, "HS256", "", secret, claims(map[string]interface{}{"sub": 1})):                       "invalid sub claim",
+	}
+
+	for token, description := range tests {
+		w := jwtRequest(handler, token)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, description)
+		assert.Equal(t, "Bearer realm=\"api\", error=\"invalid_token\", error_description=\""+description+"\"", w.Header().Get("WWW-Authenticate"), description)
+	}
+
+	// missing token
+	w := jwtRequest(handler, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer realm=\"api\"", w.Header().Get("WWW-Authenticate"))
+}
+
+func TestJWTScopes(t *testing.T) {
+	secret := []byte("secret")
+	handler := JWT(JWTConfig{Keys: StaticJWTKeySet{{Algorithm: "HS256", Key: secret}}, Scopes: []string{"read", "write"}})(principalHandler)
+
+	w := jwtRequest(handler, signJWT(t, "HS256", "", secret, map[string]interface{}{"scope": "read write admin"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = jwtRequest(handler, signJWT(t, "HS256", "", secret, map[string]interface{}{"scope": "read"}))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "Bearer error=\"insufficient_scope\", error_description=\"insufficient scope\", scope=\"read write\"", w.Header().Get("WWW-Authenticate"))
+}
+
+func TestJWTClaims(t *testing.T) {
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	timeNow = func() time.Time { return jwtTestNow }
+
+	secret := []byte("secret")
+
+	var claims *JWTClaims
+	handler := JWT(JWTConfig{Keys: StaticJWTKeySet{{Algorithm: "HS256", Key: secret}}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = GetJWTClaims(r.Context())
+	}))
+
+	jwtRequest(handler, signJWT(t, "HS256", "", secret, map[string]interface{}{
+		"iss":   "issuer",
+		"sub":   "user-1",
+		"aud":   "api",
+		"iat":   1600000000,
+		"exp":   1600000060.5,
+		"jti":   "id-1",
+		"scope": "read write",
+		"org":   "fabys",
+	}))
+
+	assert.Equal(t, "issuer", claims.Issuer)
+	assert.Equal(t, "user-1", claims.Subject)
+	assert.Equal(t, []string{"api"}, claims.Audience)
+	assert.Equal(t, time.Unix(1600000000, 0), claims.IssuedAt)
+	assert.Equal(t, time.Unix(1600000060, 500000000), claims.ExpiresAt)
+	assert.True(t, claims.NotBefore.IsZero())
+	assert.Equal(t, "id-1", claims.ID)
+	assert.Equal(t, []string{"read", "write"}, claims.Scopes)
+	assert.Equal(t, "fabys", claims.Raw["org"])
+}
+
+func TestGetJWTClaimsNoEntry(t *testing.T) {
+	claims, ok := GetJWTClaims(context.Background())
+	assert.Nil(t, claims)
+	assert.False(t, ok)
+}
+
+func TestJWTNoKeysPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("JWT did not panic")
+		}
+	}()
+
+	JWT(JWTConfig{})
+}
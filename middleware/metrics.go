@@ -0,0 +1,369 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fabysdev/fabyscore-go/server"
+)
+
+// DefaultDurationBuckets are the default request duration histogram buckets in seconds.
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets are the default response size histogram buckets in bytes.
+var DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+
+// unmatchedRoute is the route label for requests without a matched route pattern.
+const unmatchedRoute = "unmatched"
+
+// otherMethod is the method label for requests with a non standard method.
+const otherMethod = "OTHER"
+
+// metricsMethods are the methods used as method label, other methods are labelled as OTHER.
+var metricsMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// MetricsOption is the type for the Metrics options.
+type MetricsOption func(*Metrics)
+
+// MetricsNamespace sets the prefix of the metric names (e.g. "api" => api_http_requests_total).
+func MetricsNamespace(namespace string) MetricsOption {
+	return func(m *Metrics) {
+		m.namespace = namespace
+	}
+}
+
+// MetricsDurationBuckets sets the request duration histogram buckets in seconds.
+func MetricsDurationBuckets(buckets []float64) MetricsOption {
+	return func(m *Metrics) {
+		m.durationBuckets = sortedBuckets(buckets)
+	}
+}
+
+// MetricsSizeBuckets sets the response size histogram buckets in bytes.
+func MetricsSizeBuckets(buckets []float64) MetricsOption {
+	return func(m *Metrics) {
+		m.sizeBuckets = sortedBuckets(buckets)
+	}
+}
+
+// Metrics records the request count, request duration, response size and in-flight requests.
+// The metrics are labelled by method, status class (e.g. 2xx) and the matched route pattern (see server.RoutePattern).
+// Requests without a route (e.g. the not found handler of the server) are labelled as unmatched, non standard methods as OTHER.
+// Create a new instance by using NewMetrics().
+//
+//	metrics := middleware.NewMetrics()
+//	srv.Use(metrics.Middleware)
+//	srv.GET("/metrics", metrics.ServeHTTP)
+type Metrics struct {
+	namespace       string
+	durationBuckets []float64
+	sizeBuckets     []float64
+
+	mu       sync.RWMutex
+	series   map[metricsLabels]*metricsSeries
+	inFlight map[metricsLabels]*int64
+}
+
+// metricsLabels are the labels of a metrics series.
+type metricsLabels struct {
+	method string
+	route  string
+	status string
+}
+
+// metricsSeries holds the values of a metrics series.
+type metricsSeries struct {
+	mu     sync.Mutex
+	values metricsValues
+}
+
+// metricsValues are the values of a metrics series.
+type metricsValues struct {
+	count         uint64
+	durationSum   time.Duration
+	sizeSum       uint64
+	durationCount []uint64
+	sizeCount     []uint64
+}
+
+// snapshot returns a copy of the values, the counts and buckets of the copy are consistent.
+func (s *metricsSeries) snapshot() metricsValues {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := s.values
+	values.durationCount = append([]uint64(nil), s.values.durationCount...)
+	values.sizeCount = append([]uint64(nil), s.values.sizeCount...)
+
+	return values
+}
+
+// NewMetrics returns a new Metrics instance.
+func NewMetrics(options ...MetricsOption) *Metrics {
+	m := &Metrics{
+		durationBuckets: DefaultDurationBuckets,
+		sizeBuckets:     DefaultSizeBuckets,
+		series:          map[metricsLabels]*metricsSeries{},
+		inFlight:        map[metricsLabels]*int64{},
+	}
+
+	for _, option := range options {
+		option(m)
+	}
+
+	return m
+}
+
+// Middleware records the metrics of the requests.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := server.RoutePattern(r)
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		method := r.Method
+		if !metricsMethods[method] {
+			method = otherMethod
+		}
+
+		inFlight := m.loadInFlight(metricsLabels{method: method, route: route})
+		atomic.AddInt64(inFlight, 1)
+		defer atomic.AddInt64(inFlight, -1)
+
+		start := time.Now()
+		rw := newResponseWriter(w)
+
+		next.ServeHTTP(rw, r)
+
+		m.observe(metricsLabels{method: method, route: route, status: statusClass(rw.Status())}, time.Since(start), rw.Size())
+	})
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	bw := bufio.NewWriter(w)
+	m.write(bw)
+	bw.Flush()
+}
+
+// loadInFlight returns the in-flight gauge for the labels.
+func (m *Metrics) loadInFlight(labels metricsLabels) *int64 {
+	m.mu.RLock()
+	gauge, ok := m.inFlight[labels]
+	m.mu.RUnlock()
+
+	if ok {
+		return gauge
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	gauge, ok = m.inFlight[labels]
+	if !ok {
+		gauge = new(int64)
+		m.inFlight[labels] = gauge
+	}
+
+	return gauge
+}
+
+// loadSeries returns the series for the labels.
+func (m *Metrics) loadSeries(labels metricsLabels) *metricsSeries {
+	m.mu.RLock()
+	series, ok := m.series[labels]
+	m.mu.RUnlock()
+
+	if ok {
+		return series
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok = m.series[labels]
+	if !ok {
+		series = &metricsSeries{values: metricsValues{
+			durationCount: make([]uint64, len(m.durationBuckets)),
+			sizeCount:     make([]uint64, len(m.sizeBuckets)),
+		}}
+		m.series[labels] = series
+	}
+
+	return series
+}
+
+// observe records a request.
+func (m *Metrics) observe(labels metricsLabels, duration time.Duration, size int64) {
+	series := m.loadSeries(labels)
+
+	series.mu.Lock()
+	defer series.mu.Unlock()
+
+	series.values.count++
+	series.values.durationSum += duration
+	series.values.sizeSum += uint64(size)
+
+	observeBuckets(series.values.durationCount, m.durationBuckets, duration.Seconds())
+	observeBuckets(series.values.sizeCount, m.sizeBuckets, float64(size))
+}
+
+// write writes all metrics in the Prometheus text exposition format.
+func (m *Metrics) write(w *bufio.Writer) {
+	m.mu.RLock()
+	series := make([]metricsLabels, 0, len(m.series))
+	for labels := range m.series {
+		series = append(series, labels)
+	}
+
+	gauges := make([]metricsLabels, 0, len(m.inFlight))
+	for labels := range m.inFlight {
+		gauges = append(gauges, labels)
+	}
+	m.mu.RUnlock()
+
+	sortLabels(series)
+	sortLabels(gauges)
+
+	// one snapshot per series for all metrics, the counts of the histograms match the buckets
+	values := make([]metricsValues, len(series))
+	for i, labels := range series {
+		values[i] = m.loadSeries(labels).snapshot()
+	}
+
+	name := m.name("http_requests_total")
+	writeMetricHeader(w, name, "counter", "The total number of HTTP requests.")
+	for i, labels := range series {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, labels.String(), values[i].count)
+	}
+
+	name = m.name("http_request_duration_seconds")
+	writeMetricHeader(w, name, "histogram", "The HTTP request duration in seconds.")
+	for i, labels := range series {
+		writeHistogram(w, name, labels, m.durationBuckets, values[i].durationCount, values[i].durationSum.Seconds(), values[i].count)
+	}
+
+	name = m.name("http_response_size_bytes")
+	writeMetricHeader(w, name, "histogram", "The HTTP response body size in bytes.")
+	for i, labels := range series {
+		writeHistogram(w, name, labels, m.sizeBuckets, values[i].sizeCount, float64(values[i].sizeSum), values[i].count)
+	}
+
+	name = m.name("http_requests_in_flight")
+	writeMetricHeader(w, name, "gauge", "The number of HTTP requests currently being served.")
+	for _, labels := range gauges {
+		m.mu.RLock()
+		gauge := m.inFlight[labels]
+		m.mu.RUnlock()
+
+		fmt.Fprintf(w, "%s{method=\"%s\",route=\"%s\"} %d\n", name, escapeLabelValue(labels.method), escapeLabelValue(labels.route), atomic.LoadInt64(gauge))
+	}
+}
+
+// name returns the metric name with the namespace prefix.
+func (m *Metrics) name(name string) string {
+	if m.namespace == "" {
+		return name
+	}
+
+	return m.namespace + "_" + name
+}
+
+// String returns the labels in the exposition format.
+func (l metricsLabels) String() string {
+	return fmt.Sprintf("method=\"%s\",route=\"%s\",status=\"%s\"", escapeLabelValue(l.method), escapeLabelValue(l.route), l.status)
+}
+
+// observeBuckets increments the counts of all buckets with an upper bound greater than or equal to v.
+// The counts are cumulative like the exposition format.
+func observeBuckets(counts []uint64, buckets []float64, v float64) {
+	for i := len(buckets) - 1; i >= 0 && v <= buckets[i]; i-- {
+		counts[i]++
+	}
+}
+
+// writeMetricHeader writes the HELP and TYPE lines of a metric.
+func writeMetricHeader(w *bufio.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// writeHistogram writes the buckets, sum and count lines of a histogram series.
+func writeHistogram(w *bufio.Writer, name string, labels metricsLabels, buckets []float64, counts []uint64, sum float64, count uint64) {
+	l := labels.String()
+
+	for i, bucket := range buckets {
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, l, formatFloat(bucket), counts[i])
+	}
+
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, l, count)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, l, formatFloat(sum))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, l, count)
+}
+
+// statusClass returns the status class of the status code (e.g. 2xx).
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// sortedBuckets returns a sorted copy of the buckets without +Inf.
+func sortedBuckets(buckets []float64) []float64 {
+	sorted := make([]float64, 0, len(buckets))
+	for _, bucket := range buckets {
+		if !math.IsInf(bucket, 1) {
+			sorted = append(sorted, bucket)
+		}
+	}
+
+	sort.Float64s(sorted)
+
+	return sorted
+}
+
+// sortLabels sorts the labels by route, method and status.
+func sortLabels(labels []metricsLabels) {
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].route != labels[j].route {
+			return labels[i].route < labels[j].route
+		}
+
+		if labels[i].method != labels[j].method {
+			return labels[i].method < labels[j].method
+		}
+
+		return labels[i].status < labels[j].status
+	})
+}
+
+// formatFloat formats a float for the exposition format.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// labelValueReplacer escapes label values.
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabelValue escapes a label value for the exposition format.
+func escapeLabelValue(v string) string {
+	return labelValueReplacer.Replace(v)
+}
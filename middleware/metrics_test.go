@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fabysdev/fabyscore-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics(MetricsDurationBuckets([]float64{10, 1}), MetricsSizeBuckets([]float64{5, 100}))
+
+	srv := server.New()
+	srv.Use(metrics.Middleware)
+	srv.GET("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		if server.Param(r, "id") == "0" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte("user"))
+	})
+	srv.GET("/metrics", metrics.ServeHTTP)
+
+	for _, path := range []string{"/users/1", "/users/2", "/users/0"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		srv.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+
+	assert.Contains(t, body, "# HELP http_requests_total The total number of HTTP requests.\n# TYPE http_requests_total counter\n")
+	assert.Contains(t, body, "http_requests_total{method=\"GET\",route=\"/users/:id\",status=\"2xx\"} 2\n")
+	assert.Contains(t, body, "http_requests_total{method=\"GET\",route=\"/users/:id\",status=\"4xx\"} 1\n")
+	assert.NotContains(t, body, "/users/1")
+
+	assert.Contains(t, body, "# TYPE http_request_duration_seconds histogram\n")
+	assert.Contains(t, body, "http_request_duration_seconds_bucket{method=\"GET\",route=\"/users/:id\",status=\"2xx\",le=\"1\"} 2\n")
+	assert.Contains(t, body, "http_request_duration_seconds_bucket{method=\"GET\",route=\"/users/:id\",status=\"2xx\",le=\"10\"} 2\n")
+	assert.Contains(t, body, "http_request_duration_seconds_bucket{method=\"GET\",route=\"/users/:id\",status=\"2xx\",le=\"+Inf\"} 2\n")
+	assert.Contains(t, body, "http_request_duration_seconds_count{method=\"GET\",route=\"/users/:id\",status=\"2xx\"} 2\n")
+
+	assert.Contains(t, body, "http_response_size_bytes_bucket{method=\"GET\",route=\"/users/:id\",status=\"2xx\",le=\"5\"} 2\n")
+	assert.Contains(t, body, "http_response_size_bytes_bucket{method=\"GET\",route=\"/users/:id\",status=\"4xx\",le=\"5\"} 0\n")
+	assert.Contains(t, body, "http_response_size_bytes_bucket{method=\"GET\",route=\"/users/:id\",status=\"4xx\",le=\"100\"} 1\n")
+	assert.Contains(t, body, "http_response_size_bytes_sum{method=\"GET\",route=\"/users/:id\",status=\"2xx\"} 8\n")
+
+	assert.Contains(t, body, "# TYPE http_requests_in_flight gauge\n")
+	assert.Contains(t, body, "http_requests_in_flight{method=\"GET\",route=\"/users/:id\"} 0\n")
+	assert.Contains(t, body, "http_requests_in_flight{method=\"GET\",route=\"/metrics\"} 1\n")
+}
+
+func TestMetricsUnmatchedRoute(t *testing.T) {
+	metrics := NewMetrics(MetricsNamespace("api"))
+
+	handler := metrics.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	req, _ := http.NewRequest("POST", "/raw/path", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, req)
+
+	assert.Contains(t, w.Body.String(), "api_http_requests_total{method=\"POST\",route=\"unmatched\",status=\"5xx\"} 1\n")
+	assert.False(t, strings.Contains(w.Body.String(), "/raw/path"))
+}
+
+func TestMetricsServerNotFound(t *testing.T) {
+	metrics := NewMetrics()
+
+	srv := server.New()
+	srv.Use(metrics.Middleware)
+	srv.GET("/users/:id", func(w http.ResponseWriter, r *http.Request) {})
+
+	req, _ := http.NewRequest("GET", "/missing", nil)
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, req)
+
+	assert.Contains(t, w.Body.String(), "http_requests_total{method=\"GET\",route=\"unmatched\",status=\"4xx\"} 1\n")
+}
+
+func TestMetricsOtherMethod(t *testing.T) {
+	metrics := NewMetrics()
+
+	handler := metrics.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, method := range []string{"FOO", "BAR"} {
+		req, _ := http.NewRequest(method, "/", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	assert.Contains(t, w.Body.String(), "http_requests_total{method=\"OTHER\",route=\"unmatched\",status=\"2xx\"} 2\n")
+	assert.False(t, strings.Contains(w.Body.String(), "FOO"))
+}
+
+func TestMetricsSnapshot(t *testing.T) {
+	metrics := NewMetrics()
+
+	handler := metrics.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 200; j++ {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+			}
+		}()
+	}
+
+	labels := metricsLabels{method: "GET", route: unmatchedRoute, status: "2xx"}
+	for i := 0; i < 50; i++ {
+		values := metrics.loadSeries(labels).snapshot()
+		assert.Equal(t, values.count, values.sizeCount[len(values.sizeCount)-1])
+	}
+
+	wg.Wait()
+}
+
+func TestObserveBuckets(t *testing.T) {
+	buckets := []float64{1, 5, 10}
+	counts := make([]uint64, len(buckets))
+
+	observeBuckets(counts, buckets, 0.5)
+	observeBuckets(counts, buckets, 5)
+	observeBuckets(counts, buckets, 7)
+	observeBuckets(counts, buckets, 11)
+
+	assert.Equal(t, []uint64{1, 2, 3}, counts)
+}
+
+func TestSortedBuckets(t *testing.T) {
+	assert.Equal(t, []float64{1, 2, 3}, sortedBuckets([]float64{3, 1, 2}))
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	assert.Equal(t, `a\\b\"c\n`, escapeLabelValue("a\\b\"c\n"))
+}
+
+func TestStatusClass(t *testing.T) {
+	assert.Equal(t, "1xx", statusClass(101))
+	assert.Equal(t, "2xx", statusClass(204))
+	assert.Equal(t, "5xx", statusClass(503))
+}
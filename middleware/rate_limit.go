@@ -0,0 +1,326 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fabysdev/fabyscore-go/cache"
+	"github.com/fabysdev/fabyscore-go/server"
+)
+
+// RateLimitAlgorithm is the type for the rate limit algorithms.
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket refills the bucket continuously with Limit tokens per Window, bursts up to Limit are allowed.
+	TokenBucket RateLimitAlgorithm = iota
+
+	// SlidingWindow allows Limit requests in every Window, estimated with the weighted previous window count.
+	SlidingWindow
+)
+
+// RateLimitKeyFunc is the type for the functions returning the rate limit key of a request.
+// Requests with an empty key are not limited.
+type RateLimitKeyFunc func(r *http.Request) string
+
+// RateLimitByIP returns the client ip resolved by RealIP or the remote ip as key.
+func RateLimitByIP() RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		return remoteIP(r)
+	}
+}
+
+// RateLimitByHeader returns the value of the header as key (e.g. X-API-Key).
+func RateLimitByHeader(header string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(header)
+	}
+}
+
+// RateLimitByParam returns the value of the route param as key.
+func RateLimitByParam(name string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		return server.Param(r, name)
+	}
+}
+
+// RateLimitBySubject returns the authenticated subject as key, fn returns the subject of the request (e.g. a user id).
+func RateLimitBySubject(fn func(r *http.Request) string) RateLimitKeyFunc {
+	return RateLimitKeyFunc(fn)
+}
+
+// RateLimitConfig is the configuration of the RateLimit middleware.
+type RateLimitConfig struct {
+	// Limit is the number of allowed requests per Window.
+	Limit int
+
+	// Window is the duration of the limit.
+	Window time.Duration
+
+	// Algorithm is the rate limit algorithm. Defaults to TokenBucket.
+	Algorithm RateLimitAlgorithm
+
+	// Key returns the key of the request. Defaults to RateLimitByIP.
+	Key RateLimitKeyFunc
+
+	// Cache holds the rate limit state. Defaults to a cache with a cleanup every minute shared by all RateLimit middlewares.
+	Cache *cache.Cache
+
+	// Name is added to the cache keys (e.g. to find the keys of a rate limit in a shared Cache).
+	// The keys of every RateLimit middleware are separated by an id, even with the same Name.
+	Name string
+}
+
+// rateLimitShards is the number of locks of a rate limiter, requests of different keys mostly don't wait for each other.
+const rateLimitShards = 64
+
+// rateLimiterID is the id of the last created rate limiter.
+var rateLimiterID uint64
+
+// defaultRateLimitCache is the Cache shared by the rate limiters without a configured Cache.
+var defaultRateLimitCache struct {
+	once  sync.Once
+	cache *cache.Cache
+}
+
+// rateLimitCache returns the default rate limit cache, the cleanup runs for the lifetime of the process.
+func rateLimitCache() *cache.Cache {
+	defaultRateLimitCache.once.Do(func() {
+		defaultRateLimitCache.cache, _ = cache.NewWithCleanup(time.Minute)
+	})
+
+	return defaultRateLimitCache.cache
+}
+
+// name returns the name of the algorithm used in the cache keys.
+func (a RateLimitAlgorithm) name() string {
+	if a == SlidingWindow {
+		return "slidingwindow"
+	}
+
+	return "tokenbucket"
+}
+
+// tokenBucketState is the cached state of a token bucket.
+type tokenBucketState struct {
+	tokens float64
+	last   time.Time
+}
+
+// slidingWindowState is the cached state of a sliding window.
+type slidingWindowState struct {
+	start    time.Time
+	current  int
+	previous int
+}
+
+// rateLimitResult is the result of a rate limit check.
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// rateLimiter holds the RateLimit configuration.
+type rateLimiter struct {
+	locks  [rateLimitShards]sync.Mutex
+	cfg    RateLimitConfig
+	prefix string
+}
+
+// RateLimit limits the requests per key with a token bucket or sliding window.
+// Adds the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers and rejects limited requests with 429 and Retry-After.
+// Use it as server, group or route middleware to configure the limits per route or group.
+// Panics if the Limit or Window is not positive.
+func RateLimit(cfg RateLimitConfig) func(http.Handler) http.Handler {
+	if cfg.Limit <= 0 || cfg.Window <= 0 {
+		panic("RateLimit requires a positive Limit and Window")
+	}
+
+	if cfg.Key == nil {
+		cfg.Key = RateLimitByIP()
+	}
+
+	if cfg.Cache == nil {
+		cfg.Cache = rateLimitCache()
+	}
+
+	id := atomic.AddUint64(&rateLimiterID, 1)
+	l := &rateLimiter{
+		cfg:    cfg,
+		prefix: "ratelimit:" + strconv.FormatUint(id, 10) + ":" + cfg.Algorithm.name() + ":" + cfg.Name + ":",
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := l.cfg.Key(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result := l.take(l.prefix+key, timeNow())
+
+			header := w.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(l.cfg.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.reset)))
+
+			if !result.allowed {
+				header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.retryAfter)))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// take takes one request of the key's limit.
+func (l *rateLimiter) take(key string, now time.Time) rateLimitResult {
+	mu := &l.locks[shardIndex(key)]
+	mu.Lock()
+	defer mu.Unlock()
+
+	if l.cfg.Algorithm == SlidingWindow {
+		return l.takeSlidingWindow(key, now)
+	}
+
+	return l.takeTokenBucket(key, now)
+}
+
+// takeTokenBucket takes a token of the key's bucket.
+func (l *rateLimiter) takeTokenBucket(key string, now time.Time) rateLimitResult {
+	limit := float64(l.cfg.Limit)
+	rate := limit / l.cfg.Window.Seconds()
+
+	state := tokenBucketState{tokens: limit, last: now}
+	if v, ok := l.cfg.Cache.Get(key); ok {
+		if cached, ok := v.(tokenBucketState); ok {
+			state = cached
+		}
+
+		state.tokens = math.Min(limit, state.tokens+now.Sub(state.last).Seconds()*rate)
+		state.last = now
+	}
+
+	result := rateLimitResult{}
+	if state.tokens >= 1 {
+		state.tokens--
+		result.allowed = true
+	} else {
+		result.retryAfter = secondsToDuration((1 - state.tokens) / rate)
+	}
+
+	result.remaining = int(math.Floor(state.tokens))
+	result.reset = secondsToDuration((limit - state.tokens) / rate)
+
+	// a bucket is full again after the reset duration, the expired entry is equal to a new bucket
+	l.cfg.Cache.Set(key, state, cache.Expire(result.reset))
+
+	return result
+}
+
+// takeSlidingWindow counts a request in the key's window.
+func (l *rateLimiter) takeSlidingWindow(key string, now time.Time) rateLimitResult {
+	window := l.cfg.Window
+	start := now.Truncate(window)
+
+	state := slidingWindowState{start: start}
+	if v, ok := l.cfg.Cache.Get(key); ok {
+		if cached, ok := v.(slidingWindowState); ok {
+			state = cached
+		}
+
+		if !state.start.Equal(start) {
+			if state.start.Add(window).Equal(start) {
+				state.previous = state.current
+			} else {
+				state.previous = 0
+			}
+
+			state.current = 0
+			state.start = start
+		}
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(window)
+	estimated := float64(state.previous)*weight + float64(state.current)
+
+	result := rateLimitResult{
+		reset: window - elapsed,
+	}
+
+	if estimated+1 <= float64(l.cfg.Limit) {
+		state.current++
+		estimated++
+		result.allowed = true
+	} else {
+		result.retryAfter = l.slidingWindowRetryAfter(state, elapsed)
+	}
+
+	result.remaining = int(math.Max(0, math.Floor(float64(l.cfg.Limit)-estimated)))
+
+	l.cfg.Cache.Set(key, state, cache.Expire(2*window-elapsed))
+
+	return result
+}
+
+// slidingWindowRetryAfter returns the duration until the estimated count allows the next request.
+func (l *rateLimiter) slidingWindowRetryAfter(state slidingWindowState, elapsed time.Duration) time.Duration {
+	window := l.cfg.Window
+	limit := float64(l.cfg.Limit)
+
+	// the current window is already full, wait for the next window where it becomes the weighted previous count
+	if float64(state.current)+1 > limit {
+		next := window - elapsed
+		if state.current == 0 {
+			return next
+		}
+
+		// previous*(1-t/window) + 1 <= limit => t >= window*(1-(limit-1)/previous)
+		t := float64(window) * (1 - (limit-1)/float64(state.current))
+		if t < 0 {
+			t = 0
+		}
+
+		return next + time.Duration(t)
+	}
+
+	// previous*(1-t/window) + current + 1 <= limit => t >= window*(1-(limit-current-1)/previous)
+	t := float64(window) * (1 - (limit-float64(state.current)-1)/float64(state.previous))
+
+	return time.Duration(t) - elapsed
+}
+
+// shardIndex returns the lock shard of the key (FNV-1a).
+func shardIndex(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+
+	return h % rateLimitShards
+}
+
+// secondsToDuration converts the seconds into a duration.
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// ceilSeconds returns the duration in whole seconds, rounded up.
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fabysdev/fabyscore-go/cache"
+	"github.com/fabysdev/fabyscore-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func setRateLimitTime(t *testing.T, now *time.Time) {
+	timeNow = func() time.Time {
+		return *now
+	}
+
+	t.Cleanup(func() {
+		timeNow = time.Now
+	})
+}
+
+func serveRateLimit(handler http.Handler, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = remoteAddr
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestRateLimitTokenBucket(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	setRateLimitTime(t, &now)
+
+	handler := RateLimit(RateLimitConfig{Limit: 2, Window: 10 * time.Second})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	w := serveRateLimit(handler, "10.0.0.1:1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "5", w.Header().Get("RateLimit-Reset"))
+
+	w = serveRateLimit(handler, "10.0.0.1:2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "10", w.Header().Get("RateLimit-Reset"))
+
+	w = serveRateLimit(handler, "10.0.0.1:3")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	// other keys are not limited
+	w = serveRateLimit(handler, "10.0.0.2:1")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// refilled one token
+	now = now.Add(5 * time.Second)
+	w = serveRateLimit(handler, "10.0.0.1:4")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serveRateLimit(handler, "10.0.0.1:4")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+func TestRateLimitSlidingWindow(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	setRateLimitTime(t, &now)
+
+	handler := RateLimit(RateLimitConfig{Limit: 2, Window: 10 * time.Second, Algorithm: SlidingWindow})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := serveRateLimit(handler, "10.0.0.1:1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "10", w.Header().Get("RateLimit-Reset"))
+
+	now = now.Add(2 * time.Second)
+	w = serveRateLimit(handler, "10.0.0.1:1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "8", w.Header().Get("RateLimit-Reset"))
+
+	w = serveRateLimit(handler, "10.0.0.1:1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	// the previous count of 2 must be weighted below 1 => 5s into the next window
+	assert.Equal(t, "13", w.Header().Get("Retry-After"))
+
+	// next window, the previous count is weighted with 0.5
+	now = now.Add(13 * time.Second)
+	w = serveRateLimit(handler, "10.0.0.1:1")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serveRateLimit(handler, "10.0.0.1:1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+
+	// two windows later the counts are reset
+	now = now.Add(20 * time.Second)
+	w = serveRateLimit(handler, "10.0.0.1:1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	c := cache.New()
+
+	srv := server.New()
+	srv.GET("/users/:id", func(w http.ResponseWriter, r *http.Request) {}, RateLimit(RateLimitConfig{Limit: 1, Window: time.Minute, Key: RateLimitByParam("id"), Cache: c, Name: "users"}))
+	srv.Group("/api", func(g *server.Group) {
+		g.Use(RateLimit(RateLimitConfig{Limit: 1, Window: time.Minute, Key: RateLimitByHeader("X-API-Key"), Cache: c, Name: "api"}))
+
+		g.GET("/a", func(w http.ResponseWriter, r *http.Request) {})
+		g.GET("/b", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	srv.GET("/me", func(w http.ResponseWriter, r *http.Request) {}, RateLimit(RateLimitConfig{Limit: 1, Window: time.Minute, Key: RateLimitBySubject(func(r *http.Request) string {
+		return r.URL.Query().Get("user")
+	}), Cache: c, Name: "me"}))
+
+	serve := func(target string, header string) int {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("X-API-Key", header)
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/users/1", ""))
+	assert.Equal(t, http.StatusTooManyRequests, serve("/users/1", ""))
+	assert.Equal(t, http.StatusOK, serve("/users/2", ""))
+
+	// the group limit is shared by the group routes
+	assert.Equal(t, http.StatusOK, serve("/api/a", "key"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("/api/b", "key"))
+	assert.Equal(t, http.StatusOK, serve("/api/b", "other"))
+
+	// requests without a key are not limited
+	assert.Equal(t, http.StatusOK, serve("/api/a", ""))
+	assert.Equal(t, http.StatusOK, serve("/api/a", ""))
+
+	assert.Equal(t, http.StatusOK, serve("/me?user=1", ""))
+	assert.Equal(t, http.StatusTooManyRequests, serve("/me?user=1", ""))
+
+	assert.Len(t, c.Keys(), 5)
+}
+
+func TestRateLimitSharedCache(t *testing.T) {
+	c := cache.New()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	// same Name, different algorithms and limits
+	tokenBucket := RateLimit(RateLimitConfig{Limit: 1, Window: time.Minute, Cache: c, Name: "api"})(next)
+	slidingWindow := RateLimit(RateLimitConfig{Limit: 2, Window: time.Minute, Algorithm: SlidingWindow, Cache: c, Name: "api"})(next)
+
+	assert.Equal(t, http.StatusOK, serveRateLimit(tokenBucket, "10.0.0.1:1").Code)
+	assert.Equal(t, http.StatusOK, serveRateLimit(slidingWindow, "10.0.0.1:1").Code)
+	assert.Equal(t, http.StatusOK, serveRateLimit(slidingWindow, "10.0.0.1:1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serveRateLimit(tokenBucket, "10.0.0.1:1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serveRateLimit(slidingWindow, "10.0.0.1:1").Code)
+	assert.Len(t, c.Keys(), 2)
+
+	// the default cache is shared
+	assert.Equal(t, rateLimitCache(), rateLimitCache())
+}
+
+func TestRateLimitStateTypeMismatch(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := cache.New()
+
+	l := &rateLimiter{cfg: RateLimitConfig{Limit: 2, Window: 10 * time.Second, Cache: c}}
+	c.Set("key", "invalid")
+	result := l.take("key", now)
+	assert.True(t, result.allowed)
+	assert.Equal(t, 1, result.remaining)
+
+	l.cfg.Algorithm = SlidingWindow
+	result = l.take("key", now)
+	assert.True(t, result.allowed)
+	assert.Equal(t, 1, result.remaining)
+}
+
+func TestShardIndex(t *testing.T) {
+	assert.Equal(t, shardIndex("ratelimit:1:tokenbucket::10.0.0.1"), shardIndex("ratelimit:1:tokenbucket::10.0.0.1"))
+	assert.True(t, shardIndex("a") < rateLimitShards)
+	assert.NotEqual(t, shardIndex("a"), shardIndex("b"))
+}
+
+func TestRateLimitInvalidConfigPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("RateLimit did not panic")
+		}
+	}()
+
+	RateLimit(RateLimitConfig{Limit: 1})
+}
+
+func TestCeilSeconds(t *testing.T) {
+	assert.Equal(t, 0, ceilSeconds(-time.Second))
+	assert.Equal(t, 0, ceilSeconds(0))
+	assert.Equal(t, 1, ceilSeconds(time.Millisecond))
+	assert.Equal(t, 2, ceilSeconds(2*time.Second))
+}
@@ -0,0 +1,328 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/fabysdev/fabyscore-go/server"
+)
+
+// RealIPContextKey is the real ip context key.
+var RealIPContextKey = &server.ContextKey{"real-ip"}
+
+// realIPHeaders are the default headers used to resolve the client.
+var realIPHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Real-IP"}
+
+// RealIPOption is the type for the RealIP options.
+type RealIPOption func(*realIPConfig)
+
+// RealIPHeaders sets the headers used to resolve the client ip (Forwarded, X-Forwarded-For and X-Real-IP), the first existing header is used.
+// Defaults to all in this order.
+func RealIPHeaders(headers ...string) RealIPOption {
+	return func(c *realIPConfig) {
+		c.headers = headers
+	}
+}
+
+// realIPConfig holds the RealIP configuration.
+type realIPConfig struct {
+	trusted []*net.IPNet
+	headers []string
+}
+
+// isTrusted checks if the ip is in a trusted network.
+func (c *realIPConfig) isTrusted(ip net.IP) bool {
+	for _, network := range c.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// realIP is the resolved client of a request.
+type realIP struct {
+	ip     string
+	scheme string
+	host   string
+}
+
+// forwardedHop is a proxy hop of the forwarding headers.
+type forwardedHop struct {
+	ip    net.IP
+	proto string
+	host  string
+}
+
+// RealIP resolves the client ip, scheme and host of requests from trusted proxies (CIDRs or single ips).
+// The hops of the Forwarded (RFC 7239), X-Forwarded-For or X-Real-IP header are checked from right to left, the first untrusted hop is the client.
+// The headers are ignored for requests of untrusted remote addresses. The client is returned by ClientIP, ClientScheme and ClientHost.
+// Panics if a trusted network is invalid.
+func RealIP(trusted []string, options ...RealIPOption) func(http.Handler) http.Handler {
+	cfg := &realIPConfig{
+		headers: realIPHeaders,
+	}
+
+	for _, cidr := range trusted {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid trusted network. Error: %v", err))
+		}
+
+		cfg.trusted = append(cfg.trusted, network)
+	}
+
+	for _, option := range options {
+		option(cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), RealIPContextKey, cfg.resolve(r))))
+		})
+	}
+}
+
+// resolve returns the client of the request.
+func (c *realIPConfig) resolve(r *http.Request) *realIP {
+	client := &realIP{ip: peerIP(r), scheme: "http", host: r.Host}
+	if r.TLS != nil {
+		client.scheme = "https"
+	}
+
+	peer := net.ParseIP(client.ip)
+	if peer == nil || !c.isTrusted(peer) {
+		return client
+	}
+
+	hops := c.hops(r)
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := hops[i]
+		if hop.ip == nil {
+			break
+		}
+
+		client.ip = hop.ip.String()
+		if hop.proto != "" {
+			client.scheme = hop.proto
+		}
+
+		if hop.host != "" {
+			client.host = hop.host
+		}
+
+		if !c.isTrusted(hop.ip) {
+			break
+		}
+	}
+
+	return client
+}
+
+// hops returns the hops of the first existing forwarding header.
+func (c *realIPConfig) hops(r *http.Request) []forwardedHop {
+	for _, header := range c.headers {
+		values := r.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+
+		switch http.CanonicalHeaderKey(header) {
+		case "Forwarded":
+			return parseForwarded(values)
+		case "X-Forwarded-For":
+			return parseXForwardedFor(values, r.Header.Values("X-Forwarded-Proto"), r.Header.Values("X-Forwarded-Host"))
+		case "X-Real-Ip":
+			return []forwardedHop{{ip: parseForwardedIP(values[len(values)-1])}}
+		}
+	}
+
+	return nil
+}
+
+// parseForwarded returns the hops of the Forwarded header values.
+func parseForwarded(values []string) []forwardedHop {
+	hops := []forwardedHop{}
+
+	for _, element := range splitQuoted(strings.Join(values, ","), ',') {
+		hop := forwardedHop{}
+
+		for _, pair := range splitQuoted(element, ';') {
+			i := strings.IndexByte(pair, '=')
+			if i < 0 {
+				continue
+			}
+
+			name := strings.ToLower(strings.TrimSpace(pair[:i]))
+			value := strings.TrimSpace(pair[i+1:])
+			if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+				value = strings.Replace(value[1:len(value)-1], `\"`, `"`, -1)
+			}
+
+			switch name {
+			case "for":
+				hop.ip = parseForwardedIP(value)
+			case "proto":
+				hop.proto = validForwardedProto(value)
+			case "host":
+				hop.host = validForwardedHost(value)
+			}
+		}
+
+		hops = append(hops, hop)
+	}
+
+	return hops
+}
+
+// parseXForwardedFor returns the hops of the X-Forwarded-For header values.
+// The X-Forwarded-Proto and X-Forwarded-Host values are assigned per hop if the number of values match, otherwise the last value is assigned to the last hop.
+func parseXForwardedFor(values, protos, hosts []string) []forwardedHop {
+	ips := splitList(values)
+	protoList := splitList(protos)
+	hostList := splitList(hosts)
+
+	hops := make([]forwardedHop, len(ips))
+	for i, ip := range ips {
+		hops[i].ip = parseForwardedIP(ip)
+	}
+
+	assign := func(list []string, set func(hop *forwardedHop, value string)) {
+		if len(list) == len(hops) {
+			for i, value := range list {
+				set(&hops[i], value)
+			}
+		} else if len(list) > 0 && len(hops) > 0 {
+			set(&hops[len(hops)-1], list[len(list)-1])
+		}
+	}
+
+	assign(protoList, func(hop *forwardedHop, value string) { hop.proto = validForwardedProto(value) })
+	assign(hostList, func(hop *forwardedHop, value string) { hop.host = validForwardedHost(value) })
+
+	return hops
+}
+
+// splitList splits the comma separated header values.
+func splitList(values []string) []string {
+	list := []string{}
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+
+	return list
+}
+
+// splitQuoted splits s by sep outside of quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	parts := []string{}
+
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// parseForwardedIP returns the ip of a node identifier (ip, ip:port, [ipv6] or [ipv6]:port).
+// Returns nil for unknown, obfuscated and invalid identifiers.
+func parseForwardedIP(node string) net.IP {
+	node = strings.TrimSpace(node)
+
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(node, "["), "]"))
+}
+
+// validForwardedProto returns the lowercase proto if it is http or https.
+func validForwardedProto(proto string) string {
+	proto = strings.ToLower(strings.TrimSpace(proto))
+	if proto != "http" && proto != "https" {
+		return ""
+	}
+
+	return proto
+}
+
+// validForwardedHost returns the host if it contains no invalid characters.
+func validForwardedHost(host string) string {
+	host = strings.TrimSpace(host)
+	if strings.ContainsAny(host, " /\\@?#\"") {
+		return ""
+	}
+
+	return host
+}
+
+// peerIP returns the ip of the request remote address.
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// ClientIP returns the client ip resolved by RealIP from the given context.
+// Returns an empty string if no client ip was found.
+func ClientIP(ctx context.Context) string {
+	if client, ok := ctx.Value(RealIPContextKey).(*realIP); ok {
+		return client.ip
+	}
+
+	return ""
+}
+
+// ClientScheme returns the client scheme (http or https) resolved by RealIP.
+// Returns the scheme of the request connection if RealIP is not used.
+func ClientScheme(r *http.Request) string {
+	if client, ok := r.Context().Value(RealIPContextKey).(*realIP); ok {
+		return client.scheme
+	}
+
+	if r.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
+
+// ClientHost returns the client host resolved by RealIP.
+// Returns the request host if RealIP is not used.
+func ClientHost(r *http.Request) string {
+	if client, ok := r.Context().Value(RealIPContextKey).(*realIP); ok {
+		return client.host
+	}
+
+	return r.Host
+}
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func realIPRequest(remoteAddr string, headers map[string][]string) (string, string, string) {
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.RemoteAddr = remoteAddr
+	for name, values := range headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	var ip, scheme, host string
+	handler := RealIP([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, scheme, host = ClientIP(r.Context()), ClientScheme(r), ClientHost(r)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	return ip, scheme, host
+}
+
+func TestRealIPXForwardedFor(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		headers    map[string][]string
+		ip         string
+		scheme     string
+		host       string
+	}{
+		// untrusted remote address
+		{"203.0.113.1:1234", map[string][]string{"X-Forwarded-For": {"1.1.1.1"}, "X-Forwarded-Proto": {"https"}}, "203.0.113.1", "http", "example.com"},
+		// no header
+		{"10.0.0.1:1234", nil, "10.0.0.1", "http", "example.com"},
+		// single proxy
+		{"10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"1.1.1.1"}, "X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"api.example.com"}}, "1.1.1.1", "https", "api.example.com"},
+		// spoofed entries left of the first untrusted hop
+		{"10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"6.6.6.6, 1.1.1.1", "192.168.1.1"}}, "1.1.1.1", "http", "example.com"},
+		// all hops trusted
+		{"10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3", "http", "example.com"},
+		// invalid hop stops at the last trusted proxy
+		{"10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"1.1.1.1, invalid, 10.0.0.2"}}, "10.0.0.2", "http", "example.com"},
+		// per hop protos
+		{"10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"1.1.1.1, 10.0.0.2"}, "X-Forwarded-Proto": {"https, http"}}, "1.1.1.1", "https", "example.com"},
+		// invalid proto and host
+		{"10.0.0.1:1234", map[string][]string{"X-Forwarded-For": {"1.1.1.1"}, "X-Forwarded-Proto": {"javascript"}, "X-Forwarded-Host": {"evil.com/path"}}, "1.1.1.1", "http", "example.com"},
+		// ipv6 and ports
+		{"[fd00::1]:1234", map[string][]string{"X-Forwarded-For": {"[2001:db8::1]:4711"}}, "2001:db8::1", "http", "example.com"},
+		// X-Real-IP
+		{"10.0.0.1:1234", map[string][]string{"X-Real-Ip": {"1.1.1.1"}}, "1.1.1.1", "http", "example.com"},
+	}
+
+	for i, test := range tests {
+		ip, scheme, host := realIPRequest(test.remoteAddr, test.headers)
+		assert.Equal(t, test.ip, ip, i)
+		assert.Equal(t, test.scheme, scheme, i)
+		assert.Equal(t, test.host, host, i)
+	}
+}
+
+func TestRealIPForwarded(t *testing.T) {
+	tests := []struct {
+		forwarded []string
+		ip        string
+		scheme    string
+		host      string
+	}{
+		{[]string{`for=1.1.1.1;proto=https;host=api.example.com`}, "1.1.1.1", "https", "api.example.com"},
+		{[]string{`for="[2001:db8:cafe::17]:4711";proto=HTTPS`}, "2001:db8:cafe::17", "https", "example.com"},
+		{[]string{`for=6.6.6.6, for=1.1.1.1;proto=https`, `For=10.0.0.2;proto=http`}, "1.1.1.1", "https", "example.com"},
+		{[]string{`for=1.1.1.1;host="a;b,c.example.com", for=10.0.0.2`}, "1.1.1.1", "http", "a;b,c.example.com"},
+		{[]string{`for=unknown, for=10.0.0.2;proto=https`}, "10.0.0.2", "https", "example.com"},
+		{[]string{`for=_hidden`}, "10.0.0.1", "http", "example.com"},
+		{[]string{`invalid`}, "10.0.0.1", "http", "example.com"},
+	}
+
+	for _, test := range tests {
+		ip, scheme, host := realIPRequest("10.0.0.1:1234", map[string][]string{
+			"Forwarded":       test.forwarded,
+			"X-Forwarded-For": {"9.9.9.9"},
+		})
+
+		assert.Equal(t, test.ip, ip, test.forwarded)
+		assert.Equal(t, test.scheme, scheme, test.forwarded)
+		assert.Equal(t, test.host, host, test.forwarded)
+	}
+}
+
+func TestRealIPHeaders(t *testing.T) {
+	var ip string
+	handler := RealIP([]string{"10.0.0.0/8"}, RealIPHeaders("X-Real-IP"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip = ClientIP(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("Forwarded", "for=6.6.6.6")
+	req.Header.Set("X-Forwarded-For", "6.6.6.6")
+	req.Header.Set("X-Real-IP", "1.1.1.1")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "1.1.1.1", ip)
+}
+
+func TestRealIPTLS(t *testing.T) {
+	var scheme string
+	handler := RealIP(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme = ClientScheme(r)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{}
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "https", scheme)
+}
+
+func TestRealIPInvalidNetworkPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("RealIP did not panic")
+		}
+	}()
+
+	RealIP([]string{"10.0.0.0/33"})
+}
+
+func TestClientNoRealIP(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	assert.Equal(t, "", ClientIP(req.Context()))
+	assert.Equal(t, "http", ClientScheme(req))
+	assert.Equal(t, "example.com", ClientHost(req))
+
+	req.TLS = &tls.ConnectionState{}
+	assert.Equal(t, "https", ClientScheme(req))
+}
+
+func TestRemoteIPRealIP(t *testing.T) {
+	var ip string
+	handler := RealIP([]string{"10.0.0.0/8"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip = RateLimitByIP()(r)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "1.1.1.1")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "1.1.1.1", ip)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"os"
@@ -20,10 +22,116 @@ var base64Encode = base64.StdEncoding.EncodeToString
 // RequestIDContextKey is the request id context key.
 var RequestIDContextKey = &server.ContextKey{"request-id"}
 
-// RequestID adds a request id into the request context.
-// Has the form prefix-hostname-random-counter, e.g. http-localhost-ueT39830ghyR-1
+// maxRequestIDLength is the maximum length of a trusted inbound request id.
+const maxRequestIDLength = 128
+
+// RequestIDOption is the type for the RequestID options.
+type RequestIDOption func(*requestIDConfig)
+
+// requestIDConfig holds the RequestID configuration.
+type requestIDConfig struct {
+	trustHeader    string
+	responseHeader string
+	generator      func() string
+	counter        bool
+}
+
+// RequestIDTrustHeader uses the request id of the inbound header (e.g. X-Request-ID).
+// The inbound id is only used if it has at most 128 characters of [A-Za-z0-9] and -_.:+/=, otherwise a new id is generated.
+func RequestIDTrustHeader(header string) RequestIDOption {
+	return func(c *requestIDConfig) {
+		c.trustHeader = header
+	}
+}
+
+// RequestIDResponseHeader sets the request id as response header (e.g. X-Request-ID).
+func RequestIDResponseHeader(header string) RequestIDOption {
+	return func(c *requestIDConfig) {
+		c.responseHeader = header
+	}
+}
+
+// RequestIDGenerator replaces the default prefix-UUIDv7 generator (e.g. with UUIDv4 or ULID).
+// The prefix is not used by the generator.
+func RequestIDGenerator(fn func() string) RequestIDOption {
+	return func(c *requestIDConfig) {
+		c.generator = fn
+	}
+}
+
+// RequestIDCounter uses the prefix-hostname-random-counter generator, e.g. http-localhost-ueT39830ghyR-1
 // The random is only generated once per RequestID middleware (panics if generating the random fails).
-func RequestID(prefix string) func(http.Handler) http.Handler {
+// The counter exposes the request volume, only use it for internal ids.
+func RequestIDCounter() RequestIDOption {
+	return func(c *requestIDConfig) {
+		c.counter = true
+	}
+}
+
+// RequestID adds a request id into the request context.
+// Has the form prefix-UUIDv7 (only the UUIDv7 for an empty prefix), e.g. http-01890a5d-ac96-774b-bcce-b302099a8057
+func RequestID(prefix string, options ...RequestIDOption) func(http.Handler) http.Handler {
+	cfg := &requestIDConfig{}
+	for _, option := range options {
+		option(cfg)
+	}
+
+	if cfg.generator == nil {
+		if cfg.counter {
+			cfg.generator = counterGenerator(prefix)
+		} else {
+			cfg.generator = uuidGenerator(prefix)
+		}
+	}
+
+	// create middleware
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if ctx.Value(RequestIDContextKey) != nil {
+				if id := GetRequestID(ctx); cfg.responseHeader != "" && id != "" {
+					w.Header().Set(cfg.responseHeader, id)
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			id := ""
+			if cfg.trustHeader != "" {
+				if inbound := r.Header.Get(cfg.trustHeader); isValidRequestID(inbound) {
+					id = inbound
+				}
+			}
+
+			if id == "" {
+				id = cfg.generator()
+			}
+
+			if cfg.responseHeader != "" {
+				w.Header().Set(cfg.responseHeader, id)
+			}
+
+			ctx = context.WithValue(ctx, RequestIDContextKey, id)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// uuidGenerator returns the default prefix-UUIDv7 generator.
+func uuidGenerator(prefix string) func() string {
+	if prefix == "" {
+		return UUIDv7
+	}
+
+	return func() string {
+		return prefix + "-" + UUIDv7()
+	}
+}
+
+// counterGenerator returns the prefix-hostname-random-counter generator.
+func counterGenerator(prefix string) func() string {
 	// resolve hostname
 	hostname, err := osHostname()
 	if err != nil || hostname == "" {
@@ -47,22 +155,119 @@ func RequestID(prefix string) func(http.Handler) http.Handler {
 	// create final prefix
 	prefix = fmt.Sprintf("%s-%s-%s", prefix, hostname, random[:12])
 
-	// create middleware
 	var counter uint64
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := r.Context()
-			if ctx.Value(RequestIDContextKey) != nil {
-				next.ServeHTTP(w, r)
-				return
-			}
+	return func() string {
+		num := atomic.AddUint64(&counter, 1)
+		return fmt.Sprintf("%s-%d", prefix, num)
+	}
+}
 
-			num := atomic.AddUint64(&counter, 1)
-			ctx = context.WithValue(ctx, RequestIDContextKey, fmt.Sprintf("%s-%d", prefix, num))
+// isValidRequestID checks the length and charset of an inbound request id.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
 
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			continue
+		}
+
+		if !strings.ContainsRune("-_.:+/=", rune(c)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// UUIDv4 returns a random RFC 4122 version 4 UUID (panics if generating the random fails).
+func UUIDv4() string {
+	b := randomBytes(16)
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return formatUUID(b)
+}
+
+// UUIDv7 returns a time ordered version 7 UUID with a millisecond timestamp (panics if generating the random fails).
+func UUIDv7() string {
+	b := randomBytes(16)
+
+	ms := uint64(timeNow().UnixNano() / 1e6)
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+
+	b[6] = (b[6] & 0x0f) | 0x70
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return formatUUID(b)
+}
+
+// crockfordAlphabet is the ULID base32 alphabet.
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID returns a lexicographically sortable identifier with a millisecond timestamp (panics if generating the random fails).
+func ULID() string {
+	b := randomBytes(16)
+
+	ms := uint64(timeNow().UnixNano() / 1e6)
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	// 26 characters with 5 bits each encode the 128 bits, the first character only holds 3 bits
+	id := make([]byte, 26)
+	for i := range id {
+		shift := uint(125 - 5*i)
+
+		var v uint64
+		switch {
+		case shift >= 64:
+			v = hi >> (shift - 64)
+		case shift+5 <= 64:
+			v = lo >> shift
+		default:
+			v = lo>>shift | hi<<(64-shift)
+		}
+
+		id[i] = crockfordAlphabet[v&0x1f]
 	}
+
+	return string(id)
+}
+
+// formatUUID formats the 16 bytes as UUID string.
+func formatUUID(b []byte) string {
+	buf := make([]byte, 36)
+
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+
+	return string(buf)
+}
+
+// randomBytes returns n random bytes (panics if generating the random fails).
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := randRead(b); err != nil {
+		panic(fmt.Sprintf("Generating the random failed. Error: %v", err))
+	}
+
+	return b
 }
 
 // GetRequestID returns the request id from the given context.
@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/fabysdev/fabyscore-go/server"
 	"github.com/stretchr/testify/assert"
@@ -27,7 +29,7 @@ func TestRequestIDRandReadFailedPanic(t *testing.T) {
 	osHostname = func() (string, error) { return "", nil }
 	randRead = func(b []byte) (n int, err error) { return 0, errors.New("error") }
 
-	RequestID("test")
+	RequestID("test", RequestIDCounter())
 }
 
 func TestRequestIDRandomLengthPanic(t *testing.T) {
@@ -45,7 +47,7 @@ func TestRequestIDRandomLengthPanic(t *testing.T) {
 	randRead = func(b []byte) (n int, err error) { return 0, nil }
 	base64Encode = func(src []byte) string { return "" }
 
-	RequestID("test")
+	RequestID("test", RequestIDCounter())
 }
 
 func TestRequestIDAlreadyExists(t *testing.T) {
@@ -72,14 +74,6 @@ func TestRequestIDAlreadyExists(t *testing.T) {
 }
 
 func TestRequestID(t *testing.T) {
-	defer func() {
-		osHostname = os.Hostname
-		base64Encode = base64.StdEncoding.EncodeToString
-	}()
-
-	osHostname = func() (string, error) { return "", nil }
-	base64Encode = func(src []byte) string { return "randomstring" }
-
 	srv := server.New()
 	srv.Use(RequestID("prefix"))
 	srv.GET("/", func(w http.ResponseWriter, r *http.Request) {
@@ -91,7 +85,18 @@ func TestRequestID(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	srv.ServeHTTP(w, req)
-	assert.Equal(t, "prefix-localhost-randomstring-1", w.Body.String())
+	assert.True(t, strings.HasPrefix(w.Body.String(), "prefix-"))
+	assert.Len(t, w.Body.String(), len("prefix-")+36)
+	assert.Equal(t, byte('7'), w.Body.String()[len("prefix-")+14])
+
+	// no prefix
+	handler := RequestID("")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetRequestID(r.Context())))
+	}))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Len(t, w.Body.String(), 36)
 }
 
 func TestRequestIDCounterIncreases(t *testing.T) {
@@ -104,7 +109,7 @@ func TestRequestIDCounterIncreases(t *testing.T) {
 	base64Encode = func(src []byte) string { return "randomstring" }
 
 	srv := server.New()
-	srv.Use(RequestID("prefix"))
+	srv.Use(RequestID("prefix", RequestIDCounter()))
 	srv.GET("/", func(w http.ResponseWriter, r *http.Request) {
 		id := r.Context().Value(RequestIDContextKey)
 		w.Write([]byte(id.(string)))
@@ -143,3 +148,114 @@ func TestGetRequestID(t *testing.T) {
 	v := GetRequestID(ctx)
 	assert.Equal(t, v, "requestid")
 }
+
+func TestRequestIDTrustHeader(t *testing.T) {
+	handler := RequestID("prefix", RequestIDTrustHeader("X-Request-ID"), RequestIDGenerator(func() string { return "generated" }))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetRequestID(r.Context())))
+	}))
+
+	tests := map[string]string{
+		"":                            "generated",
+		"abc-123_4.5:6+7/8=":          "abc-123_4.5:6+7/8=",
+		"has space":                   "generated",
+		"<script>":                    "generated",
+		strings.Repeat("a", 128):      strings.Repeat("a", 128),
+		strings.Repeat("a", 129):      "generated",
+		"f47ac10b-58cc-4372-a567-0e0": "f47ac10b-58cc-4372-a567-0e0",
+	}
+
+	for inbound, expected := range tests {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Request-ID", inbound)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, expected, w.Body.String(), inbound)
+	}
+}
+
+func TestRequestIDResponseHeader(t *testing.T) {
+	handler := RequestID("", RequestIDResponseHeader("X-Request-ID"), RequestIDGenerator(func() string { return "generated" }))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, "generated", w.Header().Get("X-Request-ID"))
+
+	// existing request id
+	req = req.WithContext(context.WithValue(req.Context(), RequestIDContextKey, "existingkey"))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, "existingkey", w.Header().Get("X-Request-ID"))
+}
+
+func TestRequestIDGeneratorSkipsDefault(t *testing.T) {
+	defer func() {
+		randRead = rand.Read
+	}()
+
+	randRead = func(b []byte) (n int, err error) { return 0, errors.New("error") }
+
+	// the counter generator is not created
+	RequestID("test", RequestIDCounter(), RequestIDGenerator(func() string { return "" }))
+}
+
+func TestUUIDv4(t *testing.T) {
+	id := UUIDv4()
+
+	assert.Regexp(t, "^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", id)
+	assert.NotEqual(t, id, UUIDv4())
+}
+
+func TestUUIDv7(t *testing.T) {
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	timeNow = func() time.Time { return time.Unix(0, 0x0123456789ab*int64(time.Millisecond)) }
+
+	id := UUIDv7()
+	assert.Regexp(t, "^01234567-89ab-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", id)
+}
+
+func TestULID(t *testing.T) {
+	defer func() {
+		timeNow = time.Now
+		randRead = rand.Read
+	}()
+
+	timeNow = func() time.Time { return time.Unix(0, 1469918176385*int64(time.Millisecond)) }
+	randRead = func(b []byte) (n int, err error) {
+		for i := range b {
+			b[i] = 0xff
+		}
+
+		return len(b), nil
+	}
+
+	assert.Equal(t, "01ARYZ6S41ZZZZZZZZZZZZZZZZ", ULID())
+
+	randRead = func(b []byte) (n int, err error) {
+		for i := range b {
+			b[i] = 0
+		}
+
+		return len(b), nil
+	}
+
+	assert.Equal(t, "01ARYZ6S410000000000000000", ULID())
+}
+
+func TestRandomBytesPanic(t *testing.T) {
+	defer func() {
+		randRead = rand.Read
+
+		if r := recover(); r == nil {
+			t.Errorf("UUIDv4 did not panic")
+		}
+	}()
+
+	randRead = func(b []byte) (n int, err error) { return 0, errors.New("error") }
+
+	UUIDv4()
+}
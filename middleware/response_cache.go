@@ -0,0 +1,466 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fabysdev/fabyscore-go/cache"
+	"github.com/fabysdev/fabyscore-go/server"
+)
+
+// responseCachePrefix is the key prefix of the response cache entries.
+const responseCachePrefix = "response-cache\x00"
+
+// responseCachePassSuffix is the key suffix of the marker for keys with uncacheable responses.
+const responseCachePassSuffix = "\x01pass"
+
+// defaultResponseCacheMaxSize is the default maximum body size of cached responses.
+const defaultResponseCacheMaxSize = 1 << 20
+
+// defaultResponseCachePassTTL is the default duration keys with uncacheable responses skip the waiting for running requests.
+const defaultResponseCachePassTTL = 5 * time.Second
+
+// cacheableStatus are the status codes which are cached.
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// ResponseCacheOption is the type for the ResponseCache options.
+type ResponseCacheOption func(*responseCache)
+
+// ResponseCacheQueryParams sets the query params which are part of the key. Defaults to all query params.
+func ResponseCacheQueryParams(params ...string) ResponseCacheOption {
+	return func(rc *responseCache) {
+		rc.queryParams = params
+		rc.allQueryParams = false
+	}
+}
+
+// ResponseCacheDefaultTTL sets the lifetime of responses without a max-age. Defaults to 0, such responses are not cached.
+func ResponseCacheDefaultTTL(d time.Duration) ResponseCacheOption {
+	return func(rc *responseCache) {
+		rc.defaultTTL = d
+	}
+}
+
+// ResponseCacheMaxSize sets the maximum body size of cached responses. Defaults to 1MB.
+func ResponseCacheMaxSize(size int) ResponseCacheOption {
+	return func(rc *responseCache) {
+		rc.maxSize = size
+	}
+}
+
+// ResponseCachePassTTL sets how long requests for a key skip the waiting for running requests after an uncacheable response.
+// Defaults to 5 seconds, 0 disables it (requests always wait, serializing the requests of keys with uncacheable responses).
+func ResponseCachePassTTL(d time.Duration) ResponseCacheOption {
+	return func(rc *responseCache) {
+		rc.passTTL = d
+	}
+}
+
+// ResponseCacheCookies caches the responses of requests with cookies.
+// Only use it if the responses don't depend on the cookies or have a Vary: Cookie header.
+func ResponseCacheCookies() ResponseCacheOption {
+	return func(rc *responseCache) {
+		rc.cookies = true
+	}
+}
+
+// responseCacheEntry is a cached response.
+type responseCacheEntry struct {
+	status  int
+	header  http.Header
+	body    []byte
+	created time.Time
+}
+
+// responseCacheVary holds the Vary headers of the responses of a key.
+type responseCacheVary struct {
+	headers []string
+}
+
+// responseCacheFlight is a running request populating a missing entry.
+type responseCacheFlight struct {
+	done chan struct{}
+}
+
+// responseCache holds the ResponseCache configuration and the running requests.
+type responseCache struct {
+	c              *cache.Cache
+	queryParams    []string
+	allQueryParams bool
+	defaultTTL     time.Duration
+	maxSize        int
+	passTTL        time.Duration
+	cookies        bool
+
+	mu      sync.Mutex
+	flights map[string]*responseCacheFlight
+}
+
+// ResponseCache stores the GET responses (status, headers and body) in the cache.
+// The key contains the route pattern, the path, the query params, the host and the values of the response Vary headers.
+// Requests with an Authorization header or cookies (see ResponseCacheCookies) bypass the cache.
+// The lifetime is the s-maxage or max-age of the response Cache-Control, responses with no-store, no-cache, private, Set-Cookie or Vary: * are not cached.
+// Only the headers added or changed by the wrapped handler are cached, headers of the outer middlewares (e.g. the request id) are not replayed.
+// Only one request populates a missing entry, concurrent requests for the same key wait for it.
+// A waiting request is answered with 503 if it is canceled.
+// After an uncacheable response the requests of the key don't wait for a running request for the pass ttl.
+func ResponseCache(c *cache.Cache, options ...ResponseCacheOption) func(http.Handler) http.Handler {
+	rc := &responseCache{
+		c:              c,
+		allQueryParams: true,
+		maxSize:        defaultResponseCacheMaxSize,
+		passTTL:        defaultResponseCachePassTTL,
+		flights:        map[string]*responseCacheFlight{},
+	}
+
+	for _, option := range options {
+		option(rc)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "GET" || r.Header.Get("Authorization") != "" || (!rc.cookies && r.Header.Get("Cookie") != "") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := rc.key(r)
+
+			if entry, ok := rc.lookup(key, r); ok {
+				rc.serve(w, entry)
+				return
+			}
+
+			// the last response was not cacheable, waiting for a running request would only serialize the requests
+			if _, pass := rc.c.Get(key + responseCachePassSuffix); pass {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			flight, leader := rc.startFlight(key)
+			if !leader {
+				select {
+				case <-flight.done:
+				case <-r.Context().Done():
+					http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+					return
+				}
+
+				if entry, ok := rc.lookup(key, r); ok {
+					rc.serve(w, entry)
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			defer rc.endFlight(key, flight)
+
+			// headers of the outer middlewares (e.g. the request id) are set per request and not cached
+			cw := &responseCacheWriter{responseWriter: newResponseWriter(w), maxSize: rc.maxSize, before: w.Header().Clone()}
+			next.ServeHTTP(cw, r)
+
+			if !rc.store(key, r, cw) && rc.passTTL > 0 {
+				rc.c.Set(key+responseCachePassSuffix, true, cache.Expire(rc.passTTL))
+			}
+		})
+	}
+}
+
+// key returns the key of the request without the vary values.
+func (rc *responseCache) key(r *http.Request) string {
+	query := r.URL.Query()
+
+	if !rc.allQueryParams {
+		selected := url.Values{}
+		for _, param := range rc.queryParams {
+			if values, ok := query[param]; ok {
+				selected[param] = values
+			}
+		}
+
+		query = selected
+	}
+
+	return responseCachePrefix + server.RoutePattern(r) + "\x00" + r.Method + " " + r.URL.Path + "?" + query.Encode() + "\x00" + strings.ToLower(ClientHost(r))
+}
+
+// varyKey returns the entry key of the request with the values of the vary headers.
+func varyKey(key string, r *http.Request, headers []string) string {
+	var sb strings.Builder
+	sb.WriteString(key)
+	sb.WriteString("\x00")
+
+	for i, header := range headers {
+		if i > 0 {
+			sb.WriteString("\x00")
+		}
+
+		sb.WriteString(strings.Join(r.Header.Values(header), ","))
+	}
+
+	return sb.String()
+}
+
+// lookup returns the cached response of the request.
+func (rc *responseCache) lookup(key string, r *http.Request) (*responseCacheEntry, bool) {
+	v, ok := rc.c.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	vary, ok := v.(*responseCacheVary)
+	if !ok {
+		return nil, false
+	}
+
+	v, ok = rc.c.Get(varyKey(key, r, vary.headers))
+	if !ok {
+		return nil, false
+	}
+
+	entry, ok := v.(*responseCacheEntry)
+	return entry, ok
+}
+
+// serve writes the cached response.
+func (rc *responseCache) serve(w http.ResponseWriter, entry *responseCacheEntry) {
+	h := w.Header()
+	for name, values := range entry.header {
+		h[name] = append([]string(nil), values...)
+	}
+
+	h.Set("Age", strconv.FormatInt(int64(timeNow().Sub(entry.created)/time.Second), 10))
+
+	w.WriteHeader(entry.status)
+	w.Write(entry.body)
+}
+
+// startFlight returns the running request of the key, leader is true if the caller has to populate the entry.
+func (rc *responseCache) startFlight(key string) (*responseCacheFlight, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if flight, ok := rc.flights[key]; ok {
+		return flight, false
+	}
+
+	flight := &responseCacheFlight{done: make(chan struct{})}
+	rc.flights[key] = flight
+
+	return flight, true
+}
+
+// endFlight removes the running request and releases the waiting requests.
+func (rc *responseCache) endFlight(key string, flight *responseCacheFlight) {
+	rc.mu.Lock()
+	delete(rc.flights, key)
+	rc.mu.Unlock()
+
+	close(flight.done)
+}
+
+// store caches the recorded response if it is cacheable, returns false if the response was not cached.
+func (rc *responseCache) store(key string, r *http.Request, cw *responseCacheWriter) bool {
+	if cw.hijacked || cw.tooLarge {
+		return false
+	}
+
+	if cw.header == nil {
+		cw.header = cw.Header().Clone()
+	}
+
+	if !cacheableStatus[cw.Status()] || cw.header.Get("Set-Cookie") != "" {
+		return false
+	}
+
+	ttl, ok := responseCacheTTL(cw.header.Get("Cache-Control"), rc.defaultTTL)
+	if !ok {
+		return false
+	}
+
+	vary := []string{}
+	for _, value := range cw.header.Values("Vary") {
+		for _, header := range strings.Split(value, ",") {
+			header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+			if header == "*" {
+				return false
+			}
+
+			if header != "" {
+				vary = append(vary, header)
+			}
+		}
+	}
+
+	sort.Strings(vary)
+
+	header := changedHeaders(cw.before, cw.header)
+	header.Del("Age")
+
+	rc.c.Set(key, &responseCacheVary{headers: vary}, cache.Expire(ttl))
+	rc.c.Set(varyKey(key, r, vary), &responseCacheEntry{
+		status:  cw.Status(),
+		header:  header,
+		body:    cw.buf,
+		created: timeNow(),
+	}, cache.Expire(ttl))
+
+	return true
+}
+
+// changedHeaders returns the headers of after which are missing in before or have other values.
+func changedHeaders(before, after http.Header) http.Header {
+	changed := http.Header{}
+	for name, values := range after {
+		if !equalHeaderValues(before[name], values) {
+			changed[name] = append([]string(nil), values...)
+		}
+	}
+
+	return changed
+}
+
+// equalHeaderValues checks if both header values are equal.
+func equalHeaderValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// responseCacheTTL returns the lifetime of the response, false if the response must not be cached.
+func responseCacheTTL(cacheControl string, defaultTTL time.Duration) (time.Duration, bool) {
+	maxAge := -1
+	sMaxAge := -1
+
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name := strings.ToLower(strings.TrimSpace(directive))
+		value := ""
+
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name, value = strings.TrimSpace(name[:i]), strings.Trim(strings.TrimSpace(name[i+1:]), `"`)
+		}
+
+		switch name {
+		case "no-store", "no-cache", "private":
+			return 0, false
+		case "max-age", "s-maxage":
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 {
+				return 0, false
+			}
+
+			if name == "max-age" {
+				maxAge = seconds
+			} else {
+				sMaxAge = seconds
+			}
+		}
+	}
+
+	switch {
+	case sMaxAge >= 0:
+		return time.Duration(sMaxAge) * time.Second, sMaxAge > 0
+	case maxAge >= 0:
+		return time.Duration(maxAge) * time.Second, maxAge > 0
+	}
+
+	return defaultTTL, defaultTTL > 0
+}
+
+// PurgeResponseCacheRoute removes the cached responses of the route pattern (e.g. /users/:id).
+func PurgeResponseCacheRoute(c *cache.Cache, pattern string) {
+	prefix := responseCachePrefix + pattern + "\x00"
+
+	for _, key := range c.Keys() {
+		if strings.HasPrefix(key, prefix) {
+			c.Delete(key)
+		}
+	}
+}
+
+// PurgeResponseCachePrefix removes the cached responses whose method, path and query (e.g. "GET /users/1?") starts with the prefix.
+func PurgeResponseCachePrefix(c *cache.Cache, prefix string) {
+	for _, key := range c.Keys() {
+		if !strings.HasPrefix(key, responseCachePrefix) {
+			continue
+		}
+
+		parts := strings.SplitN(key, "\x00", 4)
+		if len(parts) >= 3 && strings.HasPrefix(parts[2], prefix) {
+			c.Delete(key)
+		}
+	}
+}
+
+// responseCacheWriter is a http.ResponseWriter recording the response header and body.
+type responseCacheWriter struct {
+	*responseWriter
+	maxSize  int
+	before   http.Header
+	header   http.Header
+	buf      []byte
+	tooLarge bool
+}
+
+// WriteHeader records the response header and sends it.
+func (cw *responseCacheWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+
+	cw.header = cw.Header().Clone()
+	cw.responseWriter.WriteHeader(code)
+}
+
+// Write records the data up to the maximum size and writes it.
+func (cw *responseCacheWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if !cw.tooLarge {
+		if len(cw.buf)+len(b) > cw.maxSize {
+			cw.tooLarge = true
+			cw.buf = nil
+		} else {
+			cw.buf = append(cw.buf, b...)
+		}
+	}
+
+	return cw.responseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if the wrapped ResponseWriter supports it.
+func (cw *responseCacheWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	cw.responseWriter.Flush()
+}
@@ -0,0 +1,414 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fabysdev/fabyscore-go/cache"
+	"github.com/fabysdev/fabyscore-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func responseCacheRequest(handler http.Handler, method, target string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestResponseCache(t *testing.T) {
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	calls := 0
+	handler := ResponseCache(cache.New())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "response %d", calls)
+	}))
+
+	w := responseCacheRequest(handler, "GET", "/?b=2&a=1", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "response 1", w.Body.String())
+	assert.Equal(t, "", w.Header().Get("Age"))
+
+	now = now.Add(5 * time.Second)
+
+	w = responseCacheRequest(handler, "GET", "/?a=1&b=2", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "response 1", w.Body.String())
+	assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "5", w.Header().Get("Age"))
+	assert.Equal(t, 1, calls)
+
+	// other query, other method, authorization
+	responseCacheRequest(handler, "GET", "/?a=2", nil)
+	responseCacheRequest(handler, "HEAD", "/?a=1&b=2", nil)
+	responseCacheRequest(handler, "GET", "/?a=1&b=2", map[string]string{"Authorization": "Bearer token"})
+	assert.Equal(t, 4, calls)
+}
+
+func TestResponseCacheNotCached(t *testing.T) {
+	tests := map[string]http.HandlerFunc{
+		"no cache-control": func(w http.ResponseWriter, r *http.Request) {},
+		"no-store": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60, no-store")
+		},
+		"private": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		},
+		"max-age=0": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=0")
+		},
+		"invalid max-age": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=abc")
+		},
+		"status": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.WriteHeader(http.StatusInternalServerError)
+		},
+		"set-cookie": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Set-Cookie", "session=1")
+		},
+		"vary *": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "*")
+		},
+		"too large": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Write([]byte("12345"))
+			w.Write([]byte("678901"))
+		},
+	}
+
+	for name, fn := range tests {
+		calls := 0
+		handler := ResponseCache(cache.New(), ResponseCacheMaxSize(10))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			fn(w, r)
+		}))
+
+		responseCacheRequest(handler, "GET", "/", nil)
+		responseCacheRequest(handler, "GET", "/", nil)
+		assert.Equal(t, 2, calls, name)
+	}
+}
+
+func TestResponseCacheTTL(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		defaultTTL   time.Duration
+		ttl          time.Duration
+		ok           bool
+	}{
+		{"", 0, 0, false},
+		{"", time.Minute, time.Minute, true},
+		{"public", time.Minute, time.Minute, true},
+		{"max-age=30", time.Minute, 30 * time.Second, true},
+		{"max-age=30, s-maxage=\"90\"", 0, 90 * time.Second, true},
+		{"S-MAXAGE=0, max-age=30", 0, 0, false},
+		{"max-age=-1", time.Minute, 0, false},
+		{"no-cache", time.Minute, 0, false},
+	}
+
+	for _, test := range tests {
+		ttl, ok := responseCacheTTL(test.cacheControl, test.defaultTTL)
+		assert.Equal(t, test.ttl, ttl, test.cacheControl)
+		assert.Equal(t, test.ok, ok, test.cacheControl)
+	}
+}
+
+func TestResponseCacheQueryParams(t *testing.T) {
+	calls := 0
+	handler := ResponseCache(cache.New(), ResponseCacheQueryParams("page"), ResponseCacheDefaultTTL(time.Minute))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprintf(w, "response %d", calls)
+	}))
+
+	responseCacheRequest(handler, "GET", "/?page=1&utm_source=a", nil)
+	w := responseCacheRequest(handler, "GET", "/?utm_source=b&page=1", nil)
+	assert.Equal(t, "response 1", w.Body.String())
+
+	w = responseCacheRequest(handler, "GET", "/?page=2", nil)
+	assert.Equal(t, "response 2", w.Body.String())
+}
+
+func TestResponseCacheVary(t *testing.T) {
+	calls := 0
+	handler := ResponseCache(cache.New())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "accept-language, Accept-Encoding")
+		fmt.Fprintf(w, "%s %d", r.Header.Get("Accept-Language"), calls)
+	}))
+
+	assert.Equal(t, "de 1", responseCacheRequest(handler, "GET", "/", map[string]string{"Accept-Language": "de"}).Body.String())
+	assert.Equal(t, "en 2", responseCacheRequest(handler, "GET", "/", map[string]string{"Accept-Language": "en"}).Body.String())
+	assert.Equal(t, "de 1", responseCacheRequest(handler, "GET", "/", map[string]string{"Accept-Language": "de"}).Body.String())
+	assert.Equal(t, "de 3", responseCacheRequest(handler, "GET", "/", map[string]string{"Accept-Language": "de", "Accept-Encoding": "gzip"}).Body.String())
+}
+
+func TestResponseCacheHost(t *testing.T) {
+	handler := ResponseCache(cache.New(), ResponseCacheDefaultTTL(time.Minute))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+
+	serve := func(host string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = host
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		return w.Body.String()
+	}
+
+	assert.Equal(t, "a.example", serve("a.example"))
+	assert.Equal(t, "b.example", serve("b.example"))
+	assert.Equal(t, "a.example", serve("A.example"))
+}
+
+func TestResponseCacheCookies(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Cookie")
+		fmt.Fprintf(w, "response %d", calls)
+	})
+
+	handler := ResponseCache(cache.New())(next)
+	cookie := map[string]string{"Cookie": "session=1"}
+
+	assert.Equal(t, "response 1", responseCacheRequest(handler, "GET", "/", cookie).Body.String())
+	assert.Equal(t, "response 2", responseCacheRequest(handler, "GET", "/", cookie).Body.String())
+
+	// opt in, the cookies are part of the key with Vary: Cookie
+	handler = ResponseCache(cache.New(), ResponseCacheCookies())(next)
+
+	assert.Equal(t, "response 3", responseCacheRequest(handler, "GET", "/", cookie).Body.String())
+	assert.Equal(t, "response 3", responseCacheRequest(handler, "GET", "/", cookie).Body.String())
+	assert.Equal(t, "response 4", responseCacheRequest(handler, "GET", "/", map[string]string{"Cookie": "session=2"}).Body.String())
+}
+
+func TestResponseCachePurge(t *testing.T) {
+	c := cache.New()
+	c.Set("other", "value")
+
+	var calls int32
+	srv := server.New()
+	srv.Use(ResponseCache(c, ResponseCacheDefaultTTL(time.Minute)))
+	srv.GET("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "user %d", atomic.AddInt32(&calls, 1))
+	})
+	srv.GET("/posts/:id", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "post %d", atomic.AddInt32(&calls, 1))
+	})
+
+	responseCacheRequest(srv, "GET", "/users/1", nil)
+	responseCacheRequest(srv, "GET", "/users/2", nil)
+	responseCacheRequest(srv, "GET", "/posts/1", nil)
+	assert.Equal(t, "user 1", responseCacheRequest(srv, "GET", "/users/1", nil).Body.String())
+
+	PurgeResponseCachePrefix(c, "GET /users/1?")
+	assert.Equal(t, "user 4", responseCacheRequest(srv, "GET", "/users/1", nil).Body.String())
+	assert.Equal(t, "user 2", responseCacheRequest(srv, "GET", "/users/2", nil).Body.String())
+
+	PurgeResponseCacheRoute(c, "/users/:id")
+	assert.Equal(t, "user 5", responseCacheRequest(srv, "GET", "/users/2", nil).Body.String())
+	assert.Equal(t, "post 3", responseCacheRequest(srv, "GET", "/posts/1", nil).Body.String())
+
+	_, found := c.Get("other")
+	assert.True(t, found)
+}
+
+func TestResponseCacheOuterHeaders(t *testing.T) {
+	id := 0
+	generator := func() string {
+		id++
+		return fmt.Sprintf("id-%d", id)
+	}
+
+	calls := 0
+	handler := RequestID("", RequestIDGenerator(generator), RequestIDResponseHeader("X-Request-ID"))(ResponseCache(cache.New())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("X-Handler", "handler")
+		w.Write([]byte("response"))
+	})))
+
+	w := responseCacheRequest(handler, "GET", "/", nil)
+	assert.Equal(t, "id-1", w.Header().Get("X-Request-ID"))
+
+	w = responseCacheRequest(handler, "GET", "/", nil)
+	assert.Equal(t, "response", w.Body.String())
+	assert.Equal(t, "id-2", w.Header().Get("X-Request-ID"))
+	assert.Equal(t, "handler", w.Header().Get("X-Handler"))
+	assert.Equal(t, 1, calls)
+}
+
+func TestChangedHeaders(t *testing.T) {
+	before := http.Header{"A": {"1"}, "B": {"1"}, "C": {"1"}}
+	after := http.Header{"A": {"1"}, "B": {"2"}, "C": {"1", "2"}, "D": {"1"}}
+
+	assert.Equal(t, http.Header{"B": {"2"}, "C": {"1", "2"}, "D": {"1"}}, changedHeaders(before, after))
+}
+
+func TestResponseCacheStampede(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+
+	handler := ResponseCache(cache.New())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("response"))
+	}))
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bodies[i] = responseCacheRequest(handler, "GET", "/", nil).Body.String()
+		}(i)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for _, body := range bodies {
+		assert.Equal(t, "response", body)
+	}
+}
+
+func TestResponseCacheStampedeNotCacheable(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+
+	handler := ResponseCache(cache.New())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+		}
+
+		w.Write([]byte("response"))
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		responseCacheRequest(handler, "GET", "/", nil)
+		close(done)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+
+	waiting := make(chan string)
+	go func() {
+		waiting <- responseCacheRequest(handler, "GET", "/", nil).Body.String()
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	close(release)
+	<-done
+
+	assert.Equal(t, "response", <-waiting)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestResponseCachePass(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+
+	handler := ResponseCache(cache.New())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			<-release
+		}
+
+		w.Write([]byte("response"))
+	}))
+
+	// not cacheable, the following requests don't wait for each other
+	responseCacheRequest(handler, "GET", "/", nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responseCacheRequest(handler, "GET", "/", nil)
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	close(release)
+	wg.Wait()
+}
+
+func TestResponseCachePassDisabled(t *testing.T) {
+	c := cache.New()
+	handler := ResponseCache(c, ResponseCachePassTTL(0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("response"))
+	}))
+
+	responseCacheRequest(handler, "GET", "/", nil)
+	assert.Len(t, c.Keys(), 0)
+}
+
+func TestResponseCacheWaitCanceled(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	handler := ResponseCache(cache.New())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+
+	go responseCacheRequest(handler, "GET", "/", nil)
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(w, req)
+		close(done)
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the waiting request was not canceled")
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// responseWriter is a http.ResponseWriter capturing the status code and the number of written body bytes.
+// Keeps the http.Flusher, http.Hijacker and http.Pusher support of the wrapped ResponseWriter.
+// Create a new instance by using newResponseWriter().
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+	hijacked    bool
+}
+
+// newResponseWriter returns a responseWriter wrapping w.
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w}
+}
+
+// WriteHeader records the status code and sends the response header.
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.wroteHeader {
+		return
+	}
+
+	rw.status = code
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the data and counts the written bytes.
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += int64(n)
+
+	return n, err
+}
+
+// Flush implements http.Flusher if the wrapped ResponseWriter supports it.
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		if !rw.wroteHeader {
+			rw.WriteHeader(http.StatusOK)
+		}
+
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.
+// Returns an error if the wrapped ResponseWriter does not support it.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the ResponseWriter does not implement http.Hijacker")
+	}
+
+	conn, brw, err := h.Hijack()
+	if err == nil {
+		rw.hijacked = true
+		if !rw.wroteHeader {
+			rw.status = http.StatusSwitchingProtocols
+			rw.wroteHeader = true
+		}
+	}
+
+	return conn, brw, err
+}
+
+// Push implements http.Pusher.
+// Returns http.ErrNotSupported if the wrapped ResponseWriter does not support it.
+func (rw *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := rw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+
+	return http.ErrNotSupported
+}
+
+// Unwrap returns the wrapped ResponseWriter.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Status returns the written status code, 200 if no status code was written.
+func (rw *responseWriter) Status() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+
+	return rw.status
+}
+
+// Size returns the number of written body bytes.
+func (rw *responseWriter) Size() int64 {
+	return rw.size
+}
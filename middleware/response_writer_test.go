@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+func TestResponseWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	rw := newResponseWriter(w)
+
+	assert.Equal(t, http.StatusOK, rw.Status())
+	assert.Equal(t, int64(0), rw.Size())
+
+	rw.WriteHeader(http.StatusCreated)
+	rw.WriteHeader(http.StatusInternalServerError)
+	rw.Write([]byte("hello"))
+	rw.Write([]byte(" world"))
+
+	assert.Equal(t, http.StatusCreated, rw.Status())
+	assert.Equal(t, int64(11), rw.Size())
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "hello world", w.Body.String())
+	assert.Equal(t, w, rw.Unwrap())
+}
+
+func TestResponseWriterImplicitStatus(t *testing.T) {
+	w := httptest.NewRecorder()
+	rw := newResponseWriter(w)
+
+	rw.Write([]byte("a"))
+	assert.Equal(t, http.StatusOK, rw.status)
+}
+
+func TestResponseWriterFlush(t *testing.T) {
+	w := httptest.NewRecorder()
+	rw := newResponseWriter(w)
+
+	var f http.Flusher = rw
+	f.Flush()
+
+	assert.True(t, w.Flushed)
+	assert.Equal(t, http.StatusOK, rw.status)
+}
+
+func TestResponseWriterHijack(t *testing.T) {
+	rw := newResponseWriter(httptest.NewRecorder())
+
+	_, _, err := rw.Hijack()
+	assert.Error(t, err)
+	assert.False(t, rw.hijacked)
+
+	rw = newResponseWriter(&hijackRecorder{httptest.NewRecorder()})
+
+	_, _, err = rw.Hijack()
+	assert.NoError(t, err)
+	assert.True(t, rw.hijacked)
+	assert.Equal(t, http.StatusSwitchingProtocols, rw.Status())
+}
+
+func TestResponseWriterPush(t *testing.T) {
+	rw := newResponseWriter(httptest.NewRecorder())
+	assert.Equal(t, http.ErrNotSupported, rw.Push("/a", nil))
+}
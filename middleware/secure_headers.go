@@ -0,0 +1,287 @@
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fabysdev/fabyscore-go/server"
+)
+
+// CSPNonceContextKey is the csp nonce context key.
+var CSPNonceContextKey = &server.ContextKey{"csp-nonce"}
+
+// cspNoncePlaceholder is replaced with the nonce source in the ContentSecurityPolicy.
+const cspNoncePlaceholder = "{nonce}"
+
+// maxCSPReportSize is the maximum body size of a csp report request.
+const maxCSPReportSize = 64 << 10
+
+// SecureHeadersConfig is the configuration of the SecureHeaders middleware.
+// Headers with an empty value are not set.
+type SecureHeadersConfig struct {
+	// HSTSMaxAge is the max-age of the Strict-Transport-Security header, not set if zero.
+	HSTSMaxAge time.Duration
+
+	// HSTSIncludeSubdomains adds includeSubDomains to the Strict-Transport-Security header.
+	HSTSIncludeSubdomains bool
+
+	// HSTSPreload adds preload to the Strict-Transport-Security header.
+	HSTSPreload bool
+
+	// ContentTypeNosniff sets X-Content-Type-Options: nosniff.
+	ContentTypeNosniff bool
+
+	// FrameOptions is the X-Frame-Options value (e.g. DENY or SAMEORIGIN).
+	FrameOptions string
+
+	// ReferrerPolicy is the Referrer-Policy value.
+	ReferrerPolicy string
+
+	// PermissionsPolicy is the Permissions-Policy value.
+	PermissionsPolicy string
+
+	// CrossOriginOpenerPolicy is the Cross-Origin-Opener-Policy value.
+	CrossOriginOpenerPolicy string
+
+	// CrossOriginEmbedderPolicy is the Cross-Origin-Embedder-Policy value.
+	CrossOriginEmbedderPolicy string
+
+	// CrossOriginResourcePolicy is the Cross-Origin-Resource-Policy value.
+	CrossOriginResourcePolicy string
+
+	// ContentSecurityPolicy is the Content-Security-Policy value.
+	// {nonce} is replaced with a per request 'nonce-...' source, the nonce is returned by CSPNonce.
+	ContentSecurityPolicy string
+
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only.
+	CSPReportOnly bool
+
+	// CSPReportURI adds the report-uri directive to the policy (e.g. the path of a CSPReportHandler).
+	CSPReportURI string
+}
+
+// SecureHeadersDefaults returns a preset suitable for most applications.
+// The Content-Security-Policy allows same-origin resources and scripts with the request nonce.
+func SecureHeadersDefaults() SecureHeadersConfig {
+	return SecureHeadersConfig{
+		HSTSMaxAge:              365 * 24 * time.Hour,
+		HSTSIncludeSubdomains:   true,
+		ContentTypeNosniff:      true,
+		FrameOptions:            "SAMEORIGIN",
+		ReferrerPolicy:          "strict-origin-when-cross-origin",
+		PermissionsPolicy:       "camera=(), microphone=(), geolocation=(), payment=()",
+		CrossOriginOpenerPolicy: "same-origin",
+		ContentSecurityPolicy:   "default-src 'self'; script-src 'self' {nonce}; object-src 'none'; base-uri 'self'; frame-ancestors 'self'",
+	}
+}
+
+// SecureHeadersStrict returns a preset for applications without cross-origin resources.
+// Enables HSTS preload, denies framing and isolates the browsing context (COOP/COEP/CORP).
+func SecureHeadersStrict() SecureHeadersConfig {
+	return SecureHeadersConfig{
+		HSTSMaxAge:                2 * 365 * 24 * time.Hour,
+		HSTSIncludeSubdomains:     true,
+		HSTSPreload:               true,
+		ContentTypeNosniff:        true,
+		FrameOptions:              "DENY",
+		ReferrerPolicy:            "no-referrer",
+		PermissionsPolicy:         "accelerometer=(), camera=(), geolocation=(), gyroscope=(), magnetometer=(), microphone=(), payment=(), usb=()",
+		CrossOriginOpenerPolicy:   "same-origin",
+		CrossOriginEmbedderPolicy: "require-corp",
+		CrossOriginResourcePolicy: "same-origin",
+		ContentSecurityPolicy:     "default-src 'none'; script-src {nonce} 'strict-dynamic'; style-src 'self'; img-src 'self'; font-src 'self'; connect-src 'self'; form-action 'self'; base-uri 'none'; frame-ancestors 'none'",
+	}
+}
+
+// SecureHeaders sets the security response headers.
+// A per request nonce is generated if the ContentSecurityPolicy contains {nonce}.
+func SecureHeaders(cfg SecureHeadersConfig) func(http.Handler) http.Handler {
+	headers := http.Header{}
+
+	if cfg.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.FormatInt(int64(cfg.HSTSMaxAge/time.Second), 10)
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+
+		if cfg.HSTSPreload {
+			hsts += "; preload"
+		}
+
+		headers.Set("Strict-Transport-Security", hsts)
+	}
+
+	if cfg.ContentTypeNosniff {
+		headers.Set("X-Content-Type-Options", "nosniff")
+	}
+
+	setIfNotEmpty(headers, "X-Frame-Options", cfg.FrameOptions)
+	setIfNotEmpty(headers, "Referrer-Policy", cfg.ReferrerPolicy)
+	setIfNotEmpty(headers, "Permissions-Policy", cfg.PermissionsPolicy)
+	setIfNotEmpty(headers, "Cross-Origin-Opener-Policy", cfg.CrossOriginOpenerPolicy)
+	setIfNotEmpty(headers, "Cross-Origin-Embedder-Policy", cfg.CrossOriginEmbedderPolicy)
+	setIfNotEmpty(headers, "Cross-Origin-Resource-Policy", cfg.CrossOriginResourcePolicy)
+
+	csp := cfg.ContentSecurityPolicy
+	if csp != "" && cfg.CSPReportURI != "" {
+		csp = strings.TrimRight(strings.TrimSpace(csp), ";") + "; report-uri " + cfg.CSPReportURI
+	}
+
+	cspHeader := "Content-Security-Policy"
+	if cfg.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+
+	nonce := strings.Contains(csp, cspNoncePlaceholder)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for name, values := range headers {
+				h[name] = append([]string(nil), values...)
+			}
+
+			if csp != "" {
+				if nonce {
+					n := base64.StdEncoding.EncodeToString(randomBytes(16))
+					h.Set(cspHeader, strings.Replace(csp, cspNoncePlaceholder, "'nonce-"+n+"'", -1))
+
+					r = r.WithContext(context.WithValue(r.Context(), CSPNonceContextKey, n))
+				} else {
+					h.Set(cspHeader, csp)
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setIfNotEmpty sets the header if the value is not empty.
+func setIfNotEmpty(h http.Header, name, value string) {
+	if value != "" {
+		h.Set(name, value)
+	}
+}
+
+// CSPNonce returns the csp nonce from the given context, e.g. for <script nonce="...">.
+// Returns an empty string if no nonce was found.
+func CSPNonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(CSPNonceContextKey).(string)
+	return nonce
+}
+
+// CSPReport is a content security policy violation report.
+type CSPReport struct {
+	DocumentURI        string `json:"document-uri"`
+	Referrer           string `json:"referrer"`
+	BlockedURI         string `json:"blocked-uri"`
+	ViolatedDirective  string `json:"violated-directive"`
+	EffectiveDirective string `json:"effective-directive"`
+	OriginalPolicy     string `json:"original-policy"`
+	Disposition        string `json:"disposition"`
+	SourceFile         string `json:"source-file"`
+	LineNumber         int    `json:"line-number"`
+	ColumnNumber       int    `json:"column-number"`
+	StatusCode         int    `json:"status-code"`
+	Sample             string `json:"script-sample"`
+}
+
+// reportingAPICSPReport is the body of a Reporting API csp-violation report.
+type reportingAPICSPReport struct {
+	DocumentURL        string `json:"documentURL"`
+	Referrer           string `json:"referrer"`
+	BlockedURL         string `json:"blockedURL"`
+	EffectiveDirective string `json:"effectiveDirective"`
+	OriginalPolicy     string `json:"originalPolicy"`
+	Disposition        string `json:"disposition"`
+	SourceFile         string `json:"sourceFile"`
+	LineNumber         int    `json:"lineNumber"`
+	ColumnNumber       int    `json:"columnNumber"`
+	StatusCode         int    `json:"statusCode"`
+	Sample             string `json:"sample"`
+}
+
+// CSPReportHandler returns a handler collecting content security policy violation reports.
+// Accepts application/csp-report (report-uri) and application/reports+json (Reporting API) bodies up to 64KB.
+// Responds with 204, 400 for invalid reports and 415 for other content types.
+func CSPReportHandler(fn func(r *http.Request, report CSPReport)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxCSPReportSize+1))
+		if err != nil || len(body) > maxCSPReportSize {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		var reports []CSPReport
+		switch mediaType {
+		case "application/csp-report", "application/json":
+			report := struct {
+				Report CSPReport `json:"csp-report"`
+			}{}
+
+			if err := json.Unmarshal(body, &report); err != nil {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+
+			reports = append(reports, report.Report)
+		case "application/reports+json":
+			list := []struct {
+				Type string                `json:"type"`
+				Body reportingAPICSPReport `json:"body"`
+			}{}
+
+			if err := json.Unmarshal(body, &list); err != nil {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+
+			for _, item := range list {
+				if item.Type != "csp-violation" {
+					continue
+				}
+
+				reports = append(reports, CSPReport{
+					DocumentURI:        item.Body.DocumentURL,
+					Referrer:           item.Body.Referrer,
+					BlockedURI:         item.Body.BlockedURL,
+					ViolatedDirective:  item.Body.EffectiveDirective,
+					EffectiveDirective: item.Body.EffectiveDirective,
+					OriginalPolicy:     item.Body.OriginalPolicy,
+					Disposition:        item.Body.Disposition,
+					SourceFile:         item.Body.SourceFile,
+					LineNumber:         item.Body.LineNumber,
+					ColumnNumber:       item.Body.ColumnNumber,
+					StatusCode:         item.Body.StatusCode,
+					Sample:             item.Body.Sample,
+				})
+			}
+		default:
+			http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		for _, report := range reports {
+			fn(r, report)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var nonceHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(CSPNonce(r.Context())))
+})
+
+func TestSecureHeadersDefaults(t *testing.T) {
+	handler := SecureHeaders(SecureHeadersDefaults())(nonceHandler)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	nonce := w.Body.String()
+	assert.Regexp(t, regexp.MustCompile(`^[A-Za-z0-9+/]{22}==$`), nonce)
+
+	assert.Equal(t, "max-age=31536000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "SAMEORIGIN", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "strict-origin-when-cross-origin", w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "camera=(), microphone=(), geolocation=(), payment=()", w.Header().Get("Permissions-Policy"))
+	assert.Equal(t, "same-origin", w.Header().Get("Cross-Origin-Opener-Policy"))
+	assert.Equal(t, "", w.Header().Get("Cross-Origin-Embedder-Policy"))
+	assert.Equal(t, "default-src 'self'; script-src 'self' 'nonce-"+nonce+"'; object-src 'none'; base-uri 'self'; frame-ancestors 'self'", w.Header().Get("Content-Security-Policy"))
+
+	// new nonce per request
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.NotEqual(t, nonce, w.Body.String())
+}
+
+func TestSecureHeadersStrict(t *testing.T) {
+	handler := SecureHeaders(SecureHeadersStrict())(nonceHandler)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, "max-age=63072000; includeSubDomains; preload", w.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "require-corp", w.Header().Get("Cross-Origin-Embedder-Policy"))
+	assert.Equal(t, "same-origin", w.Header().Get("Cross-Origin-Resource-Policy"))
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Security-Policy"), "default-src 'none'; script-src 'nonce-"+w.Body.String()+"' 'strict-dynamic';"))
+}
+
+func TestSecureHeadersReportOnly(t *testing.T) {
+	handler := SecureHeaders(SecureHeadersConfig{
+		ContentSecurityPolicy: "default-src 'self';",
+		CSPReportOnly:         true,
+		CSPReportURI:          "/csp-report",
+	})(nonceHandler)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, "", w.Body.String())
+	assert.Equal(t, "", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "default-src 'self'; report-uri /csp-report", w.Header().Get("Content-Security-Policy-Report-Only"))
+	assert.Equal(t, "", w.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "", w.Header().Get("X-Content-Type-Options"))
+}
+
+func TestSecureHeadersHSTSSeconds(t *testing.T) {
+	handler := SecureHeaders(SecureHeadersConfig{HSTSMaxAge: 90 * time.Second, HSTSPreload: true})(nonceHandler)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, "max-age=90; preload", w.Header().Get("Strict-Transport-Security"))
+}
+
+func TestCSPNonceNoEntry(t *testing.T) {
+	assert.Equal(t, "", CSPNonce(context.Background()))
+}
+
+func TestCSPReportHandler(t *testing.T) {
+	reports := []CSPReport{}
+	handler := CSPReportHandler(func(r *http.Request, report CSPReport) {
+		reports = append(reports, report)
+	})
+
+	req := httptest.NewRequest("POST", "/csp-report", strings.NewReader(`{"csp-report": {"document-uri": "https://example.com/", "blocked-uri": "inline", "violated-directive": "script-src", "line-number": 10}}`))
+	req.Header.Set("Content-Type", "application/csp-report")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []CSPReport{{DocumentURI: "https://example.com/", BlockedURI: "inline", ViolatedDirective: "script-src", LineNumber: 10}}, reports)
+
+	reports = reports[:0]
+	req = httptest.NewRequest("POST", "/csp-report", strings.NewReader(`[
+		{"type": "csp-violation", "body": {"documentURL": "https://example.com/", "blockedURL": "https://evil.com/x.js", "effectiveDirective": "script-src-elem", "disposition": "enforce", "statusCode": 200}},
+		{"type": "deprecation", "body": {}}
+	]`))
+	req.Header.Set("Content-Type", "application/reports+json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []CSPReport{{
+		DocumentURI:        "https://example.com/",
+		BlockedURI:         "https://evil.com/x.js",
+		ViolatedDirective:  "script-src-elem",
+		EffectiveDirective: "script-src-elem",
+		Disposition:        "enforce",
+		StatusCode:         200,
+	}}, reports)
+}
+
+func TestCSPReportHandlerInvalid(t *testing.T) {
+	handler := CSPReportHandler(func(r *http.Request, report CSPReport) {
+		t.Errorf("unexpected report")
+	})
+
+	tests := []struct {
+		method      string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"GET", "application/csp-report", "", http.StatusMethodNotAllowed},
+		{"POST", "text/plain", "{}", http.StatusUnsupportedMediaType},
+		{"POST", "application/csp-report", "invalid", http.StatusBadRequest},
+		{"POST", "application/reports+json", "{}", http.StatusBadRequest},
+		{"POST", "application/csp-report", `{"csp-report": {"document-uri": "` + strings.Repeat("a", 64<<10) + `"}}`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "/csp-report", strings.NewReader(test.body))
+		req.Header.Set("Content-Type", test.contentType)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, test.status, w.Code, test.contentType)
+	}
+}
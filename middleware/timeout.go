@@ -2,11 +2,15 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"time"
+
+	"github.com/fabysdev/fabyscore-go/server"
 )
 
 // Timeout creates a TimeoutHandler and updates the request context with the given timeout.
+// The TimeoutHandler buffers the response, use ContextTimeout for streaming handlers.
 func Timeout(timeout time.Duration) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
@@ -19,3 +23,135 @@ func Timeout(timeout time.Duration) func(http.Handler) http.Handler {
 		return http.TimeoutHandler(http.HandlerFunc(fn), timeout, "Request Timeout")
 	}
 }
+
+// TimeoutResponder is the type for the functions writing the timeout response.
+type TimeoutResponder func(w http.ResponseWriter, r *http.Request)
+
+// TimeoutOption is the type for the ContextTimeout options.
+type TimeoutOption func(*timeoutConfig)
+
+// timeoutConfig holds the ContextTimeout configuration.
+type timeoutConfig struct {
+	responder TimeoutResponder
+	routes    map[string]time.Duration
+}
+
+// TimeoutResponse sets the responder for the timeout response.
+// Defaults to a 503 with the plain text "Request Timeout".
+func TimeoutResponse(fn TimeoutResponder) TimeoutOption {
+	return func(c *timeoutConfig) {
+		c.responder = fn
+	}
+}
+
+// TimeoutRoute overrides the timeout for the route pattern (e.g. /reports/:id, see server.RoutePattern).
+func TimeoutRoute(pattern string, timeout time.Duration) TimeoutOption {
+	return func(c *timeoutConfig) {
+		c.routes[pattern] = timeout
+	}
+}
+
+// TimeoutJSONResponder returns a TimeoutResponder writing a json problem body (RFC 7807) with the given status (e.g. 503 or 504).
+func TimeoutJSONResponder(status int) TimeoutResponder {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(status)
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"type":   "about:blank",
+			"title":  http.StatusText(status),
+			"status": status,
+			"detail": "Request Timeout",
+		})
+	}
+}
+
+// defaultTimeoutResponder writes the default timeout response.
+func defaultTimeoutResponder(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte("Request Timeout"))
+}
+
+// ContextTimeout updates the request context with the given timeout without buffering the response.
+// Keeps the http.Flusher support (e.g. for streaming and server-sent events), the handler must stop when the context is done.
+// Writes after the timeout return http.ErrHandlerTimeout. The responder writes the timeout response if the handler did not write a response before the timeout.
+func ContextTimeout(timeout time.Duration, options ...TimeoutOption) func(http.Handler) http.Handler {
+	cfg := &timeoutConfig{
+		responder: defaultTimeoutResponder,
+		routes:    map[string]time.Duration{},
+	}
+
+	for _, option := range options {
+		option(cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := timeout
+			if len(cfg.routes) > 0 {
+				if routeTimeout, ok := cfg.routes[server.RoutePattern(r)]; ok {
+					d = routeTimeout
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{
+				responseWriter: newResponseWriter(w),
+				ctx:            ctx,
+			}
+
+			next.ServeHTTP(tw, r.WithContext(ctx))
+
+			if ctx.Err() == context.DeadlineExceeded && !tw.wroteHeader {
+				cfg.responder(w, r)
+			}
+		})
+	}
+}
+
+// TimeoutRemaining returns the remaining time until the deadline of the context.
+// Returns false if the context has no deadline.
+func TimeoutRemaining(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+
+	return deadline.Sub(timeNow()), true
+}
+
+// timeoutWriter is a responseWriter rejecting writes after the context deadline.
+type timeoutWriter struct {
+	*responseWriter
+	ctx context.Context
+}
+
+// WriteHeader sends the response header if the deadline is not exceeded.
+func (tw *timeoutWriter) WriteHeader(code int) {
+	if tw.ctx.Err() == context.DeadlineExceeded {
+		return
+	}
+
+	tw.responseWriter.WriteHeader(code)
+}
+
+// Write writes the data if the deadline is not exceeded.
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	if tw.ctx.Err() == context.DeadlineExceeded {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	return tw.responseWriter.Write(b)
+}
+
+// Flush flushes the data if the deadline is not exceeded.
+func (tw *timeoutWriter) Flush() {
+	if tw.ctx.Err() == context.DeadlineExceeded {
+		return
+	}
+
+	tw.responseWriter.Flush()
+}
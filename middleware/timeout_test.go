@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -58,3 +59,128 @@ func TestNoTimeout(t *testing.T) {
 
 	assert.Equal(t, "test", string(buf))
 }
+
+func TestContextTimeout(t *testing.T) {
+	handler := ContextTimeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+
+		_, err := w.Write([]byte("test"))
+		assert.Equal(t, http.ErrHandlerTimeout, err)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "Request Timeout", w.Body.String())
+}
+
+func TestContextTimeoutNoTimeout(t *testing.T) {
+	handler := ContextTimeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("test"))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "test", w.Body.String())
+}
+
+func TestContextTimeoutStreaming(t *testing.T) {
+	srv := server.New()
+	srv.Use(ContextTimeout(100 * time.Millisecond))
+	srv.GET("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for i := 0; ; i++ {
+			if _, err := w.Write([]byte("data: tick\n\n")); err != nil {
+				return
+			}
+
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(30 * time.Millisecond):
+			}
+		}
+	})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	assert.NoError(t, err)
+
+	// the first event is flushed before the handler finishes
+	buf := make([]byte, 12)
+	_, err = res.Body.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "data: tick\n\n", string(buf))
+
+	body, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.True(t, len(body) > 0)
+	assert.NotContains(t, string(body), "Request Timeout")
+}
+
+func TestContextTimeoutResponder(t *testing.T) {
+	handler := ContextTimeout(time.Millisecond, TimeoutResponse(TimeoutJSONResponder(http.StatusGatewayTimeout)))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "{\"detail\":\"Request Timeout\",\"status\":504,\"title\":\"Gateway Timeout\",\"type\":\"about:blank\"}\n", w.Body.String())
+}
+
+func TestContextTimeoutRoute(t *testing.T) {
+	srv := server.New()
+	srv.Use(ContextTimeout(time.Millisecond, TimeoutRoute("/reports/:id", time.Hour)))
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		remaining, ok := TimeoutRemaining(r.Context())
+		assert.True(t, ok)
+
+		if remaining > time.Minute {
+			w.Write([]byte("long"))
+			return
+		}
+
+		<-r.Context().Done()
+	}
+
+	srv.GET("/reports/:id", handler)
+	srv.GET("/users/:id", handler)
+
+	req := httptest.NewRequest("GET", "/reports/1", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, "long", w.Body.String())
+
+	req = httptest.NewRequest("GET", "/users/1", nil)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestTimeoutRemaining(t *testing.T) {
+	_, ok := TimeoutRemaining(context.Background())
+	assert.False(t, ok)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	remaining, ok := TimeoutRemaining(ctx)
+	assert.True(t, ok)
+	assert.True(t, remaining > 59*time.Second && remaining <= time.Minute)
+}
@@ -0,0 +1,353 @@
+package middleware
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fabysdev/fabyscore-go/server"
+)
+
+// TraceContextKey is the span context key.
+var TraceContextKey = &server.ContextKey{"trace"}
+
+const (
+	traceparentHeader = "Traceparent"
+	tracestateHeader  = "Tracestate"
+
+	// maxTracestateLength is the maximum length of a propagated tracestate header.
+	maxTracestateLength = 512
+)
+
+// Span is the timing and status of a request.
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	TraceState   string
+	Sampled      bool
+	Name         string
+	Method       string
+	Route        string
+	Start        time.Time
+	Duration     time.Duration
+	Status       int
+}
+
+// traceparent returns the W3C traceparent header value of the span.
+func (s *Span) traceparent() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+
+	return "00-" + s.TraceID + "-" + s.SpanID + "-" + flags
+}
+
+// SpanExporter is the interface for span exporters.
+// Export is called concurrently for every finished and sampled span.
+type SpanExporter interface {
+	Export(span Span)
+}
+
+// JSONSpanExporter writes the spans as json lines.
+// Create a new instance by using NewJSONSpanExporter() or NewStdoutSpanExporter().
+type JSONSpanExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// spanJSON is the json representation of a span.
+type spanJSON struct {
+	TraceID      string  `json:"trace_id"`
+	SpanID       string  `json:"span_id"`
+	ParentSpanID string  `json:"parent_span_id,omitempty"`
+	TraceState   string  `json:"trace_state,omitempty"`
+	Name         string  `json:"name"`
+	Method       string  `json:"method"`
+	Route        string  `json:"route,omitempty"`
+	Start        string  `json:"start"`
+	DurationMS   float64 `json:"duration_ms"`
+	Status       int     `json:"status"`
+}
+
+// NewJSONSpanExporter returns a JSONSpanExporter writing into w.
+func NewJSONSpanExporter(w io.Writer) *JSONSpanExporter {
+	return &JSONSpanExporter{w: w}
+}
+
+// NewStdoutSpanExporter returns a JSONSpanExporter writing into stdout.
+func NewStdoutSpanExporter() *JSONSpanExporter {
+	return NewJSONSpanExporter(os.Stdout)
+}
+
+// Export writes the span as json line.
+func (e *JSONSpanExporter) Export(span Span) {
+	line, err := json.Marshal(spanJSON{
+		TraceID:      span.TraceID,
+		SpanID:       span.SpanID,
+		ParentSpanID: span.ParentSpanID,
+		TraceState:   span.TraceState,
+		Name:         span.Name,
+		Method:       span.Method,
+		Route:        span.Route,
+		Start:        span.Start.Format(time.RFC3339Nano),
+		DurationMS:   float64(span.Duration) / float64(time.Millisecond),
+		Status:       span.Status,
+	})
+	if err != nil {
+		return
+	}
+
+	line = append(line, '\n')
+
+	e.mu.Lock()
+	e.w.Write(line)
+	e.mu.Unlock()
+}
+
+// MemorySpanExporter keeps the spans in memory (e.g. for tests).
+type MemorySpanExporter struct {
+	mu    sync.Mutex
+	spans []Span
+}
+
+// NewMemorySpanExporter returns a new MemorySpanExporter.
+func NewMemorySpanExporter() *MemorySpanExporter {
+	return &MemorySpanExporter{}
+}
+
+// Export adds the span.
+func (e *MemorySpanExporter) Export(span Span) {
+	e.mu.Lock()
+	e.spans = append(e.spans, span)
+	e.mu.Unlock()
+}
+
+// Spans returns a copy of the exported spans.
+func (e *MemorySpanExporter) Spans() []Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]Span{}, e.spans...)
+}
+
+// Reset removes all exported spans.
+func (e *MemorySpanExporter) Reset() {
+	e.mu.Lock()
+	e.spans = nil
+	e.mu.Unlock()
+}
+
+// TraceOption is the type for the Trace options.
+type TraceOption func(*traceConfig)
+
+// traceConfig holds the Trace configuration.
+type traceConfig struct {
+	requestID bool
+}
+
+// TraceRequestID uses the trace id as request id.
+// Trace must be executed before RequestID, RequestID keeps an existing request id.
+func TraceRequestID() TraceOption {
+	return func(c *traceConfig) {
+		c.requestID = true
+	}
+}
+
+// Trace creates a span per request and propagates the W3C Trace Context (traceparent and tracestate headers).
+// The span is a child of the inbound traceparent or starts a new trace, is named after the method and route pattern and exported to the exporter if sampled.
+// The response contains the traceparent header of the span.
+func Trace(exporter SpanExporter, options ...TraceOption) func(http.Handler) http.Handler {
+	cfg := &traceConfig{}
+	for _, option := range options {
+		option(cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			span := &Span{
+				SpanID:  newSpanID(),
+				Sampled: true,
+				Method:  r.Method,
+				Route:   server.RoutePattern(r),
+				Start:   timeNow(),
+			}
+
+			if traceID, parentID, sampled, ok := parseTraceparent(r.Header.Get(traceparentHeader)); ok {
+				span.TraceID = traceID
+				span.ParentSpanID = parentID
+				span.Sampled = sampled
+				span.TraceState = parseTracestate(r.Header.Values(tracestateHeader))
+			} else {
+				span.TraceID = newTraceID()
+			}
+
+			span.Name = span.Method
+			if span.Route != "" {
+				span.Name += " " + span.Route
+			}
+
+			w.Header().Set(traceparentHeader, span.traceparent())
+			if span.TraceState != "" {
+				w.Header().Set(tracestateHeader, span.TraceState)
+			}
+
+			ctx := context.WithValue(r.Context(), TraceContextKey, span)
+			if cfg.requestID && ctx.Value(RequestIDContextKey) == nil {
+				ctx = context.WithValue(ctx, RequestIDContextKey, span.TraceID)
+			}
+
+			rw := newResponseWriter(w)
+
+			next.ServeHTTP(rw, r.WithContext(ctx))
+
+			span.Duration = timeNow().Sub(span.Start)
+			span.Status = rw.Status()
+
+			if span.Sampled && exporter != nil {
+				exporter.Export(*span)
+			}
+		})
+	}
+}
+
+// GetSpan returns a copy of the current span from the given context.
+// Returns false if no span was found.
+func GetSpan(ctx context.Context) (Span, bool) {
+	if span, ok := ctx.Value(TraceContextKey).(*Span); ok {
+		return *span, true
+	}
+
+	return Span{}, false
+}
+
+// TraceTransport returns a http.RoundTripper propagating the trace context of the request context to outbound requests.
+// Uses http.DefaultTransport if base is nil.
+//
+//	client := &http.Client{Transport: middleware.TraceTransport(nil)}
+//	client.Do(req.WithContext(r.Context()))
+func TraceTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &traceTransport{base: base}
+}
+
+// traceTransport is the http.RoundTripper of TraceTransport.
+type traceTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip adds the traceparent and tracestate headers of the span in the request context.
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	span, ok := req.Context().Value(TraceContextKey).(*Span)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set(traceparentHeader, span.traceparent())
+	if span.TraceState != "" {
+		req.Header.Set(tracestateHeader, span.TraceState)
+	} else {
+		req.Header.Del(tracestateHeader)
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// parseTraceparent parses a version 00 compatible traceparent header value.
+// Returns false if the value is invalid.
+func parseTraceparent(value string) (traceID, parentID string, sampled bool, ok bool) {
+	value = strings.TrimSpace(value)
+
+	// version-traceid-parentid-flags, future versions may append fields
+	if len(value) < 55 || (len(value) > 55 && value[55] != '-') {
+		return "", "", false, false
+	}
+
+	if value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return "", "", false, false
+	}
+
+	version := value[:2]
+	traceID = value[3:35]
+	parentID = value[36:52]
+	flags := value[53:55]
+
+	if !isLowerHex(version) || version == "ff" || (version == "00" && len(value) != 55) {
+		return "", "", false, false
+	}
+
+	if !isLowerHex(traceID) || traceID == strings.Repeat("0", 32) {
+		return "", "", false, false
+	}
+
+	if !isLowerHex(parentID) || parentID == strings.Repeat("0", 16) {
+		return "", "", false, false
+	}
+
+	if !isLowerHex(flags) {
+		return "", "", false, false
+	}
+
+	b, _ := hex.DecodeString(flags)
+
+	return traceID, parentID, b[0]&0x01 == 0x01, true
+}
+
+// parseTracestate returns the combined tracestate header values.
+// Returns an empty string if the value exceeds the maximum length.
+func parseTracestate(values []string) string {
+	members := []string{}
+	for _, value := range values {
+		for _, member := range strings.Split(value, ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				members = append(members, member)
+			}
+		}
+	}
+
+	state := strings.Join(members, ",")
+	if len(state) > maxTracestateLength {
+		return ""
+	}
+
+	return state
+}
+
+// isLowerHex checks if s only contains lowercase hex characters.
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newTraceID returns a random trace id.
+func newTraceID() string {
+	return randomHex(16)
+}
+
+// newSpanID returns a random span id.
+func newSpanID() string {
+	return randomHex(8)
+}
+
+// randomHex returns n random bytes as hex string (panics if generating the random fails).
+func randomHex(n int) string {
+	return hex.EncodeToString(randomBytes(n))
+}
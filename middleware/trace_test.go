@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fabysdev/fabyscore-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestTrace(t *testing.T) {
+	exporter := NewMemorySpanExporter()
+
+	srv := server.New()
+	srv.Use(Trace(exporter))
+	srv.GET("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		span, ok := GetSpan(r.Context())
+		assert.True(t, ok)
+		w.Write([]byte(span.TraceID))
+	})
+
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Add("tracestate", "rojo=00f067aa0ba902b7")
+	req.Header.Add("tracestate", "congo=t61rcWkgMzE")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", w.Body.String())
+
+	spans := exporter.Spans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].ParentSpanID)
+	assert.Len(t, spans[0].SpanID, 16)
+	assert.NotEqual(t, "00f067aa0ba902b7", spans[0].SpanID)
+	assert.Equal(t, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE", spans[0].TraceState)
+	assert.Equal(t, "GET /users/:id", spans[0].Name)
+	assert.Equal(t, "/users/:id", spans[0].Route)
+	assert.Equal(t, http.StatusOK, spans[0].Status)
+	assert.True(t, spans[0].Sampled)
+	assert.False(t, spans[0].Start.IsZero())
+
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+spans[0].SpanID+"-01", w.Header().Get("traceparent"))
+	assert.Equal(t, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE", w.Header().Get("tracestate"))
+}
+
+func TestTraceNewTrace(t *testing.T) {
+	exporter := NewMemorySpanExporter()
+
+	handler := Trace(exporter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("traceparent", "invalid")
+	req.Header.Set("tracestate", "ignored=1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	spans := exporter.Spans()
+	assert.Len(t, spans, 1)
+	assert.Len(t, spans[0].TraceID, 32)
+	assert.Equal(t, "", spans[0].ParentSpanID)
+	assert.Equal(t, "", spans[0].TraceState)
+	assert.Equal(t, "POST", spans[0].Name)
+	assert.Equal(t, http.StatusTeapot, spans[0].Status)
+	assert.Equal(t, "", w.Header().Get("tracestate"))
+
+	exporter.Reset()
+	assert.Len(t, exporter.Spans(), 0)
+}
+
+func TestTraceNotSampled(t *testing.T) {
+	exporter := NewMemorySpanExporter()
+
+	handler := Trace(exporter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Len(t, exporter.Spans(), 0)
+	assert.True(t, strings.HasSuffix(w.Header().Get("traceparent"), "-00"))
+}
+
+func TestTraceRequestID(t *testing.T) {
+	srv := server.New()
+	srv.UseWithSorting(Trace(nil, TraceRequestID()), -1)
+	srv.Use(RequestID("test"))
+	srv.GET("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetRequestID(r.Context())))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", w.Body.String())
+}
+
+func TestTraceTransport(t *testing.T) {
+	var outbound *http.Request
+	transport := TraceTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		outbound = req
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+
+	// without span
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	transport.RoundTrip(req)
+	assert.Equal(t, req, outbound)
+	assert.Equal(t, "", outbound.Header.Get("traceparent"))
+
+	handler := Trace(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span, _ := GetSpan(r.Context())
+
+		req := httptest.NewRequest("GET", "http://example.com/", nil).WithContext(r.Context())
+		req.Header.Set("tracestate", "old=1")
+		transport.RoundTrip(req)
+
+		assert.Equal(t, "", req.Header.Get("traceparent"))
+		assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+span.SpanID+"-01", outbound.Header.Get("traceparent"))
+		assert.Equal(t, "", outbound.Header.Get("tracestate"))
+	}))
+
+	inbound := httptest.NewRequest("GET", "/", nil)
+	inbound.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), inbound)
+
+	assert.Equal(t, http.DefaultTransport, TraceTransport(nil).(*traceTransport).base)
+}
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, parentID, sampled, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	assert.Equal(t, "00f067aa0ba902b7", parentID)
+	assert.True(t, sampled)
+
+	_, _, sampled, ok = parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-02")
+	assert.True(t, ok)
+	assert.False(t, sampled)
+
+	// future versions may have additional fields
+	_, _, _, ok = parseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.True(t, ok)
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0x",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01x",
+	}
+
+	for _, value := range invalid {
+		_, _, _, ok := parseTraceparent(value)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestParseTracestate(t *testing.T) {
+	assert.Equal(t, "a=1,b=2,c=3", parseTracestate([]string{"a=1, b=2", " c=3,"}))
+	assert.Equal(t, "", parseTracestate([]string{strings.Repeat("a", 513)}))
+}
+
+func TestJSONSpanExporter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	exporter := NewJSONSpanExporter(buf)
+
+	exporter.Export(Span{TraceID: "t", SpanID: "s", Name: "GET /", Method: "GET", Route: "/", Status: 200})
+
+	assert.True(t, strings.HasPrefix(buf.String(), "{\"trace_id\":\"t\",\"span_id\":\"s\",\"name\":\"GET /\",\"method\":\"GET\",\"route\":\"/\",\"start\":"))
+	assert.True(t, strings.HasSuffix(buf.String(), ",\"duration_ms\":0,\"status\":200}\n"))
+
+	assert.NotNil(t, NewStdoutSpanExporter())
+}
+
+func TestRandomHexPanic(t *testing.T) {
+	defer func() {
+		randRead = rand.Read
+
+		if r := recover(); r == nil {
+			t.Errorf("randomHex did not panic")
+		}
+	}()
+
+	randRead = func(b []byte) (n int, err error) { return 0, errors.New("error") }
+
+	newTraceID()
+}
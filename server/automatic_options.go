@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// serveAutomaticOptions answers an OPTIONS request for a path without an OPTIONS route but with routes for other methods.
+// The automatic OPTIONS handler is executed with the server middlewares (e.g. to answer CORS preflights).
+// Returns false if no route exists for the path.
+func (s *Server) serveAutomaticOptions(w http.ResponseWriter, req *http.Request) bool {
+	if s.optionsHandler == nil {
+		return false
+	}
+
+	methods, pattern := s.router.allowedMethods(req)
+	if len(methods) == 0 {
+		return false
+	}
+
+	w.Header().Set("Allow", strings.Join(append(methods, "OPTIONS"), ", "))
+
+	req = req.WithContext(context.WithValue(req.Context(), routePatternContextKey, pattern))
+	s.optionsHandler.ServeHTTP(w, req)
+
+	return true
+}
+
+// serveAutomaticOptions is the http handler func for the automatic OPTIONS response.
+func serveAutomaticOptions(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowedMethods returns the sorted methods with a route for the request path and the pattern of the first route.
+func (r *router) allowedMethods(req *http.Request) ([]string, string) {
+	if !strings.HasPrefix(req.URL.Path, "/") {
+		return nil, ""
+	}
+
+	methods := []string{}
+	pattern := ""
+
+	for _, t := range r.trees {
+		if t.method == "OPTIONS" {
+			continue
+		}
+
+		node, _, params := t.root.resolve(req, r.pool)
+		r.resetParams(params)
+
+		if node == nil || node.fn == nil {
+			continue
+		}
+
+		methods = append(methods, t.method)
+		if pattern == "" {
+			pattern = node.pattern
+		}
+	}
+
+	sort.Strings(methods)
+
+	return methods, pattern
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutomaticOptions(t *testing.T) {
+	srv := New()
+	srv.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Middleware", RoutePattern(r))
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	srv.GET("/users/:id", handler)
+	srv.PUT("/users/:id", handler)
+	srv.DELETE("/users/:id", handler)
+	srv.POST("/accounts", handler)
+	srv.OPTIONS("/custom", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("custom"))
+	})
+
+	req, _ := http.NewRequest("OPTIONS", "/users/1", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "DELETE, GET, PUT, OPTIONS", w.Header().Get("Allow"))
+	assert.Equal(t, "/users/:id", w.Header().Get("X-Middleware"))
+
+	req, _ = http.NewRequest("OPTIONS", "/accounts", nil)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "POST, OPTIONS", w.Header().Get("Allow"))
+
+	// registered OPTIONS routes are not changed
+	req, _ = http.NewRequest("OPTIONS", "/custom", nil)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "custom", w.Body.String())
+	assert.Equal(t, "", w.Header().Get("Allow"))
+
+	// no route for the path
+	req, _ = http.NewRequest("OPTIONS", "/missing", nil)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req, _ = http.NewRequest("OPTIONS", "*", nil)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAutomaticOptionsWithoutRoutes(t *testing.T) {
+	srv := New()
+
+	req, _ := http.NewRequest("OPTIONS", "/", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
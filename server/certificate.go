@@ -0,0 +1,364 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// certificatePair is a certificate with the files it was loaded from.
+type certificatePair struct {
+	certFile, keyFile       string
+	certModTime, keyModTime time.Time
+	certificate             *tls.Certificate
+}
+
+// CertificateLoader loads tls certificates and reloads them if the files change.
+// Use GetCertificate as `tls.Config`.`GetCertificate`.
+// Create a new instance by using NewCertificateLoader() or NewCertificateDirLoader().
+type CertificateLoader struct {
+	dir      string
+	reloadMu sync.Mutex
+
+	mu    sync.RWMutex
+	pairs []*certificatePair
+	names map[string]*tls.Certificate
+}
+
+// NewCertificateLoader returns a CertificateLoader for the given certificate and key file.
+func NewCertificateLoader(certFile, keyFile string) (*CertificateLoader, error) {
+	l := &CertificateLoader{
+		pairs: []*certificatePair{{certFile: certFile, keyFile: keyFile}},
+	}
+
+	if err := l.reload(true); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// NewCertificateDirLoader returns a CertificateLoader for all certificates in the given directory.
+// Every `name.crt` file with a matching `name.key` file is loaded. The certificate is selected by the SNI server name.
+// The first certificate (sorted by file name) is used if no certificate matches the server name.
+func NewCertificateDirLoader(dir string) (*CertificateLoader, error) {
+	l := &CertificateLoader{
+		dir: dir,
+	}
+
+	if err := l.reload(true); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// GetCertificate returns the certificate for the server name of the client hello.
+// See `tls.Config`.`GetCertificate`.
+func (l *CertificateLoader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		if c, found := l.names[name]; found {
+			return c, nil
+		}
+
+		if i := strings.IndexByte(name, '.'); i > 0 {
+			if c, found := l.names["*"+name[i:]]; found {
+				return c, nil
+			}
+		}
+	}
+
+	for _, p := range l.pairs {
+		if p.certificate != nil {
+			return p.certificate, nil
+		}
+	}
+
+	return nil, errors.New("no certificate available")
+}
+
+// Reload loads all certificates.
+// A certificate which fails to load is not replaced, the previously loaded certificate is still used.
+func (l *CertificateLoader) Reload() error {
+	return l.reload(true)
+}
+
+// ReloadModified loads all certificates with changed file modification times and new certificates in the directory.
+// A certificate which fails to load is not replaced, the previously loaded certificate is still used.
+func (l *CertificateLoader) ReloadModified() error {
+	return l.reload(false)
+}
+
+// Watch starts a go routine calling ReloadModified in the given interval.
+// Reload errors are passed to onError if set. The returned channel is used to stop the watcher.
+func (l *CertificateLoader) Watch(interval time.Duration, onError func(error)) chan bool {
+	stop := make(chan bool)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ticker.C:
+				if err := l.ReloadModified(); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-stop:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return stop
+}
+
+// reload loads the certificates, only modified certificates are loaded if force is false.
+func (l *CertificateLoader) reload(force bool) error {
+	l.reloadMu.Lock()
+	defer l.reloadMu.Unlock()
+
+	l.mu.RLock()
+	pairs := append([]*certificatePair{}, l.pairs...)
+	l.mu.RUnlock()
+
+	if l.dir != "" {
+		var err error
+		pairs, err = scanCertificateDir(l.dir, pairs)
+		if err != nil {
+			return err
+		}
+	}
+
+	var errs []string
+	loaded := make([]*certificatePair, len(pairs))
+	for i, p := range pairs {
+		loaded[i] = p
+
+		certInfo, err := os.Stat(p.certFile)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		keyInfo, err := os.Stat(p.keyFile)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		if !force && p.certificate != nil && certInfo.ModTime().Equal(p.certModTime) && keyInfo.ModTime().Equal(p.keyModTime) {
+			continue
+		}
+
+		certificate, err := loadCertificate(p.certFile, p.keyFile, p.certificate != nil)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		loaded[i] = &certificatePair{
+			certFile:    p.certFile,
+			keyFile:     p.keyFile,
+			certModTime: certInfo.ModTime(),
+			keyModTime:  keyInfo.ModTime(),
+			certificate: certificate,
+		}
+	}
+
+	// index the certificates by name, the first certificate wins
+	names := map[string]*tls.Certificate{}
+	hasCertificate := false
+	for _, p := range loaded {
+		if p.certificate == nil {
+			continue
+		}
+
+		hasCertificate = true
+
+		leaf := p.certificate.Leaf
+		certNames := leaf.DNSNames
+		if len(certNames) == 0 && leaf.Subject.CommonName != "" {
+			certNames = []string{leaf.Subject.CommonName}
+		}
+
+		for _, name := range certNames {
+			name = strings.ToLower(name)
+			if _, found := names[name]; !found {
+				names[name] = p.certificate
+			}
+		}
+	}
+
+	if !hasCertificate {
+		errs = append(errs, "no certificate loaded")
+	}
+
+	l.mu.Lock()
+	l.pairs = loaded
+	l.names = names
+	l.mu.Unlock()
+
+	if len(errs) != 0 {
+		return fmt.Errorf("loading certificates failed: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// scanCertificateDir returns the certificate pairs of the directory.
+// Existing pairs are kept to reuse the loaded certificate.
+func scanCertificateDir(dir string, existing []*certificatePair) ([]*certificatePair, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byCertFile := map[string]*certificatePair{}
+	for _, p := range existing {
+		byCertFile[p.certFile] = p
+	}
+
+	certFiles := []string{}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".crt" {
+			continue
+		}
+
+		certFiles = append(certFiles, filepath.Join(dir, f.Name()))
+	}
+
+	sort.Strings(certFiles)
+
+	pairs := make([]*certificatePair, 0, len(certFiles))
+	for _, certFile := range certFiles {
+		if p, found := byCertFile[certFile]; found {
+			pairs = append(pairs, p)
+			continue
+		}
+
+		keyFile := strings.TrimSuffix(certFile, ".crt") + ".key"
+		if _, err := os.Stat(keyFile); err != nil {
+			continue
+		}
+
+		pairs = append(pairs, &certificatePair{certFile: certFile, keyFile: keyFile})
+	}
+
+	return pairs, nil
+}
+
+// loadCertificate loads and validates the certificate pair.
+// An expired certificate is only accepted on the initial load, a replacement must be valid.
+func loadCertificate(certFile, keyFile string, isReplacement bool) (*tls.Certificate, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if isReplacement && time.Now().After(leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate '%s' is expired", certFile)
+	}
+
+	certificate.Leaf = leaf
+
+	return &certificate, nil
+}
+
+// watchCertificates reloads the certificates on SIGHUP and checks the files for modifications in the configured interval.
+// Closing the returned channel stops the watcher.
+func watchCertificates(cfg *config, loaders []*CertificateLoader) chan bool {
+	stop := make(chan bool)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hup)
+
+		var tick <-chan time.Time
+		if cfg.certificateReloadInterval > 0 {
+			ticker := time.NewTicker(cfg.certificateReloadInterval)
+			defer ticker.Stop()
+
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-hup:
+				for _, l := range loaders {
+					if err := l.Reload(); err != nil {
+						cfg.logf("server: %v", err)
+					}
+				}
+			case <-tick:
+				for _, l := range loaders {
+					if err := l.ReloadModified(); err != nil {
+						cfg.logf("server: %v", err)
+					}
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return stop
+}
+
+// prepareTLSConfig configures the `http.Server`.`TLSConfig` for http/2 the same way `http.Server`.`ServeTLS` does.
+func prepareTLSConfig(srv *http.Server) {
+	if srv.TLSConfig == nil {
+		srv.TLSConfig = &tls.Config{}
+	} else {
+		srv.TLSConfig = srv.TLSConfig.Clone()
+	}
+
+	if srv.TLSNextProto == nil && !containsString(srv.TLSConfig.NextProtos, "h2") {
+		srv.TLSConfig.NextProtos = append([]string{"h2"}, srv.TLSConfig.NextProtos...)
+	}
+
+	if !containsString(srv.TLSConfig.NextProtos, "http/1.1") {
+		srv.TLSConfig.NextProtos = append(srv.TLSConfig.NextProtos, "http/1.1")
+	}
+}
+
+// listenerTLSConfig returns the tls config of srv using the certificates of the loader.
+func listenerTLSConfig(srv *http.Server, loader *CertificateLoader) *tls.Config {
+	c := srv.TLSConfig.Clone()
+	c.Certificates = nil
+	c.GetCertificate = loader.GetCertificate
+
+	return c
+}
+
+// containsString returns whether the slice contains the string.
+func containsString(slice []string, str string) bool {
+	for _, s := range slice {
+		if s == str {
+			return true
+		}
+	}
+
+	return false
+}
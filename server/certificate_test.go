@@ -0,0 +1,241 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCertificateLoader(t *testing.T) {
+	dir := t.TempDir()
+	writeCertificate(t, dir, "server", time.Now().Add(time.Hour), "localhost")
+
+	l, err := NewCertificateLoader(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	assert.NoError(t, err)
+
+	c, err := l.GetCertificate(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"localhost"}, c.Leaf.DNSNames)
+
+	_, err = NewCertificateLoader(filepath.Join(dir, "missing.crt"), filepath.Join(dir, "server.key"))
+	assert.Error(t, err)
+}
+
+func TestCertificateLoaderReloadKeepsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	writeCertificate(t, dir, "server", time.Now().Add(time.Hour), "localhost")
+
+	l, err := NewCertificateLoader(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	assert.NoError(t, err)
+
+	before, _ := l.GetCertificate(&tls.ClientHelloInfo{})
+
+	// invalid file
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "server.crt"), []byte("invalid"), 0600))
+	assert.Error(t, l.Reload())
+
+	c, err := l.GetCertificate(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, before, c)
+
+	// expired certificate
+	writeCertificate(t, dir, "server", time.Now().Add(-time.Hour), "localhost")
+	err = l.Reload()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is expired")
+
+	c, err = l.GetCertificate(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, before, c)
+}
+
+func TestCertificateLoaderReloadModified(t *testing.T) {
+	dir := t.TempDir()
+	writeCertificate(t, dir, "server", time.Now().Add(time.Hour), "localhost")
+
+	l, err := NewCertificateLoader(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	assert.NoError(t, err)
+
+	before, _ := l.GetCertificate(&tls.ClientHelloInfo{})
+
+	assert.NoError(t, l.ReloadModified())
+	c, _ := l.GetCertificate(&tls.ClientHelloInfo{})
+	assert.Equal(t, before, c)
+
+	writeCertificate(t, dir, "server", time.Now().Add(time.Hour), "example.com")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "server.crt"), future, future)
+
+	assert.NoError(t, l.ReloadModified())
+	c, _ = l.GetCertificate(&tls.ClientHelloInfo{})
+	assert.NotEqual(t, before, c)
+	assert.Equal(t, []string{"example.com"}, c.Leaf.DNSNames)
+}
+
+func TestCertificateLoaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeCertificate(t, dir, "server", time.Now().Add(time.Hour), "localhost")
+
+	l, err := NewCertificateLoader(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	assert.NoError(t, err)
+
+	errs := make(chan error, 10)
+	stop := l.Watch(5*time.Millisecond, func(err error) {
+		errs <- err
+	})
+	defer close(stop)
+
+	os.Remove(filepath.Join(dir, "server.key"))
+
+	select {
+	case err := <-errs:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Error("Watch did not report the error after 1s")
+	}
+
+	c, err := l.GetCertificate(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+}
+
+func TestCertificateDirLoader(t *testing.T) {
+	dir := t.TempDir()
+	writeCertificate(t, dir, "a", time.Now().Add(time.Hour), "a.example.com")
+	writeCertificate(t, dir, "b", time.Now().Add(time.Hour), "*.example.org")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "c.crt"), []byte("no key"), 0600))
+
+	l, err := NewCertificateDirLoader(dir)
+	assert.NoError(t, err)
+
+	c, err := l.GetCertificate(&tls.ClientHelloInfo{ServerName: "A.example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.example.com"}, c.Leaf.DNSNames)
+
+	c, err = l.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.org"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*.example.org"}, c.Leaf.DNSNames)
+
+	c, err = l.GetCertificate(&tls.ClientHelloInfo{ServerName: "unknown.net"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.example.com"}, c.Leaf.DNSNames)
+
+	// new certificates are added on reload
+	writeCertificate(t, dir, "d", time.Now().Add(time.Hour), "d.example.com")
+	assert.NoError(t, l.ReloadModified())
+
+	c, err = l.GetCertificate(&tls.ClientHelloInfo{ServerName: "d.example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d.example.com"}, c.Leaf.DNSNames)
+
+	_, err = NewCertificateDirLoader(t.TempDir())
+	assert.EqualError(t, err, "loading certificates failed: no certificate loaded")
+
+	_, err = NewCertificateDirLoader(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestCertificateLoaderNoCertificate(t *testing.T) {
+	l := &CertificateLoader{}
+
+	_, err := l.GetCertificate(&tls.ClientHelloInfo{})
+	assert.EqualError(t, err, "no certificate available")
+}
+
+func TestPrepareTLSConfig(t *testing.T) {
+	srv := &http.Server{}
+	prepareTLSConfig(srv)
+	assert.Equal(t, []string{"h2", "http/1.1"}, srv.TLSConfig.NextProtos)
+
+	c := &tls.Config{NextProtos: []string{"http/1.1"}}
+	srv = &http.Server{TLSConfig: c, TLSNextProto: map[string]func(*http.Server, *tls.Conn, http.Handler){}}
+	prepareTLSConfig(srv)
+	assert.Equal(t, []string{"http/1.1"}, srv.TLSConfig.NextProtos)
+	assert.NotSame(t, c, srv.TLSConfig)
+}
+
+func TestRunTLSHTTP2(t *testing.T) {
+	dir := t.TempDir()
+	writeCertificate(t, dir, "server", time.Now().Add(time.Hour), "localhost")
+
+	srv := New()
+	srv.GET("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+
+	result := make(chan error)
+	go func() {
+		result <- srv.RunTLS("127.0.0.1:8770", filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), CertificateReloadInterval(0))
+	}()
+
+	<-time.After(100 * time.Millisecond)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: true,
+		},
+	}
+
+	res, err := client.Get("https://127.0.0.1:8770/")
+	assert.NoError(t, err)
+	if err == nil {
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(t, "HTTP/2.0", string(body))
+	}
+
+	srv.quit <- os.Interrupt
+
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Error(errors.New("Server did not shutdown after 1s"))
+	}
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+func writeCertificate(t *testing.T, dir, name string, notAfter time.Time, dnsNames ...string) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject: pkix.Name{
+			Organization: []string{"FabysCore-GO"},
+		},
+		NotBefore:             notAfter.Add(-24 * time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              dnsNames,
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	assert.NoError(t, err)
+
+	keyBytes, err := x509.MarshalECPrivateKey(priv)
+	assert.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600))
+}
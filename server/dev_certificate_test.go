@@ -0,0 +1,106 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateDevCertificate(t *testing.T) {
+	dev, err := generateDevCertificate("localhost", "127.0.0.1", "::1")
+	assert.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	assert.True(t, roots.AppendCertsFromPEM(dev.caPEM))
+
+	leaf := dev.certificate.Leaf
+	assert.Equal(t, []string{"localhost"}, leaf.DNSNames)
+	assert.Len(t, leaf.IPAddresses, 2)
+
+	for _, host := range []string{"localhost", "127.0.0.1", "::1"} {
+		_, err = leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots})
+		assert.NoError(t, err, host)
+	}
+
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots})
+	assert.Error(t, err)
+}
+
+func TestDevCertificateOption(t *testing.T) {
+	dev, err := generateDevCertificate("localhost")
+	assert.NoError(t, err)
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	cfg := newConfig([]Option{TLSConfig(tlsConfig), devCertificateOption(dev)})
+
+	assert.Equal(t, dev, cfg.devCertificate)
+	assert.Len(t, cfg.srv.TLSConfig.Certificates, 1)
+	assert.Equal(t, uint16(tls.VersionTLS12), cfg.srv.TLSConfig.MinVersion)
+	assert.Len(t, tlsConfig.Certificates, 0)
+}
+
+func TestRunTLSRequiresCertificate(t *testing.T) {
+	srv := New()
+
+	err := srv.RunMulti([]Listener{{Addr: "127.0.0.1:8771", TLS: true}})
+	assert.EqualError(t, err, "listener '127.0.0.1:8771' requires a certificate in the TLSConfig option")
+}
+
+func TestRunTLSDevCAFileError(t *testing.T) {
+	srv := New()
+
+	err := srv.RunTLSDev("127.0.0.1:8771", DevCAFile(filepath.Join(t.TempDir(), "missing", "ca.pem")))
+	assert.Error(t, err)
+}
+
+func TestRunTLSDev(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+
+	srv := New()
+	srv.GET("/", routeHandler)
+
+	result := make(chan error)
+	go func() {
+		result <- srv.RunTLSDev("127.0.0.1:8771", DevCAFile(caFile))
+	}()
+
+	<-time.After(100 * time.Millisecond)
+
+	caPEM, err := ioutil.ReadFile(caFile)
+	assert.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots},
+			ForceAttemptHTTP2: true,
+		},
+	}
+
+	res, err := client.Get("https://127.0.0.1:8771/")
+	assert.NoError(t, err)
+	if err == nil {
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(t, "r", string(body))
+		assert.Equal(t, 2, res.ProtoMajor)
+	}
+
+	srv.quit <- os.Interrupt
+
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Error("Server did not shutdown after 1s")
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// h2cHandler serves HTTP/2 over cleartext (prior knowledge and `Upgrade: h2c`) on the plain listeners.
+// The hijacked h2c connections are counted to wait for them during the graceful shutdown.
+type h2cHandler struct {
+	handler http.Handler
+	h2c     http.Handler
+	active  int64
+}
+
+// newH2CHandler returns a h2cHandler for the handler and configures HTTP/2 for srv.
+// The graceful shutdown of srv notifies the HTTP/2 connections to finish their streams.
+func newH2CHandler(srv *http.Server, handler http.Handler) (*h2cHandler, error) {
+	h2s := &http2.Server{
+		IdleTimeout: srv.IdleTimeout,
+	}
+
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return nil, err
+	}
+
+	return &h2cHandler{
+		handler: handler,
+		h2c:     h2c.NewHandler(handler, h2s),
+	}, nil
+}
+
+// See http.Handler interface's ServeHTTP.
+func (h *h2cHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.TLS != nil || !isH2CRequest(r) {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	atomic.AddInt64(&h.active, 1)
+	defer atomic.AddInt64(&h.active, -1)
+
+	h.h2c.ServeHTTP(w, r)
+}
+
+// wait blocks until all h2c connections are closed or the context is done.
+func (h *h2cHandler) wait(ctx context.Context) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for atomic.LoadInt64(&h.active) > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// isH2CRequest returns whether the request starts a h2c connection.
+func isH2CRequest(r *http.Request) bool {
+	if r.Method == "PRI" && r.Proto == "HTTP/2.0" {
+		return true
+	}
+
+	for _, upgrade := range r.Header.Values("Upgrade") {
+		for _, protocol := range strings.Split(upgrade, ",") {
+			if strings.EqualFold(strings.TrimSpace(protocol), "h2c") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+)
+
+func TestIsH2CRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	assert.False(t, isH2CRequest(req))
+
+	req.Header.Set("Upgrade", "websocket")
+	assert.False(t, isH2CRequest(req))
+
+	req.Header.Set("Upgrade", "foo, H2C")
+	assert.True(t, isH2CRequest(req))
+
+	req = httptest.NewRequest("PRI", "*", nil)
+	req.Proto = "HTTP/2.0"
+	assert.True(t, isH2CRequest(req))
+}
+
+func TestH2CHandlerWait(t *testing.T) {
+	h := &h2cHandler{active: 1}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	h.wait(ctx)
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+
+	h.active = 0
+	h.wait(context.Background())
+}
+
+func TestH2C(t *testing.T) {
+	srv := New()
+	srv.GET("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sleep") != "" {
+			time.Sleep(200 * time.Millisecond)
+		}
+
+		w.Write([]byte(r.Proto))
+	})
+
+	result := make(chan error)
+	go func() {
+		result <- srv.Run("127.0.0.1:8772", H2C())
+	}()
+
+	<-time.After(100 * time.Millisecond)
+
+	// prior knowledge
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+
+	res, err := client.Get("http://127.0.0.1:8772/")
+	assert.NoError(t, err)
+	if err == nil {
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(t, "HTTP/2.0", string(body))
+	}
+
+	// upgrade
+	conn, err := net.Dial("tcp", "127.0.0.1:8772")
+	assert.NoError(t, err)
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: 127.0.0.1\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: AAMAAABkAARAAAAAAAIAAAAA\r\n\r\n"))
+	status, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 101 Switching Protocols\r\n", status)
+	conn.Write([]byte(http2.ClientPreface))
+	http2.NewFramer(conn, nil).WriteSettings()
+	<-time.After(10 * time.Millisecond)
+	conn.Close()
+
+	// http/1.1
+	res, err = http.Get("http://127.0.0.1:8772/")
+	assert.NoError(t, err)
+	if err == nil {
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(t, "HTTP/1.1", string(body))
+	}
+
+	// the graceful shutdown drains the running streams
+	streamResult := make(chan string)
+	go func() {
+		res, err := client.Get("http://127.0.0.1:8772/?sleep=1")
+		if err != nil {
+			streamResult <- err.Error()
+			return
+		}
+
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		streamResult <- string(body)
+	}()
+
+	<-time.After(50 * time.Millisecond)
+	srv.quit <- os.Interrupt
+
+	assert.Equal(t, "HTTP/2.0", <-streamResult)
+
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Error("Server did not shutdown after 2s")
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReadinessCheck is the type for readiness check functions.
+// The context is canceled after the timeout of the check.
+type ReadinessCheck func(ctx context.Context) error
+
+// readinessCheck is a named ReadinessCheck with a timeout.
+type readinessCheck struct {
+	name    string
+	timeout time.Duration
+	fn      ReadinessCheck
+}
+
+// healthStatus is the json response of the health endpoints.
+type healthStatus struct {
+	Status string                       `json:"status"`
+	Checks map[string]healthCheckStatus `json:"checks,omitempty"`
+}
+
+// healthCheckStatus is the json result of a readiness check.
+type healthCheckStatus struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// health holds the endpoint paths and the readiness checks.
+type health struct {
+	livenessPath  string
+	readinessPath string
+
+	mu     sync.RWMutex
+	checks []readinessCheck
+}
+
+// EnableHealth adds the liveness and readiness endpoints (e.g. "/healthz" and "/readyz").
+// The liveness endpoint always responds with 200 while the process is running.
+// The readiness endpoint responds with 503 as soon as the graceful shutdown begins or if a readiness check fails.
+// An empty path skips the endpoint. The endpoints are not limited by MaxInFlight.
+func (s *Server) EnableHealth(livenessPath, readinessPath string) {
+	s.health.livenessPath = livenessPath
+	s.health.readinessPath = readinessPath
+
+	if livenessPath != "" {
+		s.GET(livenessPath, func(w http.ResponseWriter, r *http.Request) {
+			writeHealthStatus(w, http.StatusOK, healthStatus{Status: "ok"})
+		})
+	}
+
+	if readinessPath != "" {
+		s.GET(readinessPath, s.serveReadiness)
+	}
+}
+
+// isHealthRequest checks if the request is for the liveness or readiness endpoint.
+func (h *health) isHealthRequest(req *http.Request) bool {
+	if req.Method != "GET" || req.URL.Path == "" {
+		return false
+	}
+
+	return req.URL.Path == h.livenessPath || req.URL.Path == h.readinessPath
+}
+
+// AddReadinessCheck adds a named readiness check with a timeout to the readiness endpoint.
+func (s *Server) AddReadinessCheck(name string, timeout time.Duration, fn ReadinessCheck) {
+	s.health.mu.Lock()
+	s.health.checks = append(s.health.checks, readinessCheck{
+		name:    name,
+		timeout: timeout,
+		fn:      fn,
+	})
+	s.health.mu.Unlock()
+}
+
+// serveReadiness is the http handler func for the readiness endpoint.
+func (s *Server) serveReadiness(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&s.shuttingDown) == 1 {
+		writeHealthStatus(w, http.StatusServiceUnavailable, healthStatus{Status: "shutting down"})
+		return
+	}
+
+	s.health.mu.RLock()
+	checks := s.health.checks
+	s.health.mu.RUnlock()
+
+	status := healthStatus{Status: "ok"}
+	code := http.StatusOK
+
+	if len(checks) > 0 {
+		status.Checks = make(map[string]healthCheckStatus, len(checks))
+
+		results := make([]healthCheckStatus, len(checks))
+
+		var wg sync.WaitGroup
+		for i, check := range checks {
+			wg.Add(1)
+			go func(i int, check readinessCheck) {
+				defer wg.Done()
+				results[i] = runReadinessCheck(r.Context(), check)
+			}(i, check)
+		}
+
+		wg.Wait()
+
+		for i, check := range checks {
+			status.Checks[check.name] = results[i]
+
+			if results[i].Status != "ok" {
+				status.Status = "unavailable"
+				code = http.StatusServiceUnavailable
+			}
+		}
+	}
+
+	writeHealthStatus(w, code, status)
+}
+
+// runReadinessCheck runs the check and returns the result.
+// A check not returning within the timeout fails.
+func runReadinessCheck(ctx context.Context, check readinessCheck) healthCheckStatus {
+	if check.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, check.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- check.fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = errors.New("timeout")
+	}
+
+	status := healthCheckStatus{
+		Status:   "ok",
+		Duration: time.Since(start).String(),
+	}
+
+	if err != nil {
+		status.Status = "error"
+		status.Error = err.Error()
+	}
+
+	return status
+}
+
+// writeHealthStatus writes the status as json response.
+func writeHealthStatus(w http.ResponseWriter, code int, status healthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+
+	json.NewEncoder(w).Encode(status)
+}
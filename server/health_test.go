@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnableHealth(t *testing.T) {
+	srv := New()
+	srv.EnableHealth("/healthz", "/readyz")
+
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "{\"status\":\"ok\"}\n", w.Body.String())
+
+	req, _ = http.NewRequest("GET", "/readyz", nil)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "{\"status\":\"ok\"}\n", w.Body.String())
+}
+
+func TestEnableHealthSkipsEmptyPath(t *testing.T) {
+	srv := New()
+	srv.EnableHealth("", "/readyz")
+
+	assert.Equal(t, "GET:\n/\n  readyz\n\n\n", srv.router.dumpTree())
+}
+
+func TestReadinessChecks(t *testing.T) {
+	srv := New()
+	srv.EnableHealth("/healthz", "/readyz")
+
+	srv.AddReadinessCheck("db", time.Second, func(ctx context.Context) error {
+		return nil
+	})
+
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "\"db\":{\"status\":\"ok\"")
+
+	srv.AddReadinessCheck("cache", time.Second, func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+
+	srv.AddReadinessCheck("slow", 10*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "\"status\":\"unavailable\"")
+	assert.Contains(t, w.Body.String(), "\"db\":{\"status\":\"ok\"")
+	assert.Contains(t, w.Body.String(), "\"error\":\"connection refused\"")
+	assert.Contains(t, w.Body.String(), "\"error\":\"timeout\"")
+
+	// liveness is not affected by the readiness checks
+	req, _ = http.NewRequest("GET", "/healthz", nil)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestReadinessShutdown(t *testing.T) {
+	srv := New()
+	srv.EnableHealth("/healthz", "/readyz")
+
+	result := make(chan error)
+	go func() {
+		result <- srv.Run("127.0.0.1:8773", ShutdownDelay(200*time.Millisecond))
+	}()
+
+	<-time.After(100 * time.Millisecond)
+
+	res, err := http.Get("http://127.0.0.1:8773/readyz")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res.Body.Close()
+
+	srv.quit <- os.Interrupt
+	<-time.After(50 * time.Millisecond)
+
+	res, err = http.Get("http://127.0.0.1:8773/readyz")
+	assert.NoError(t, err)
+	if err == nil {
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		assert.Equal(t, "{\"status\":\"shutting down\"}\n", string(body))
+	}
+
+	res, err = http.Get("http://127.0.0.1:8773/healthz")
+	assert.NoError(t, err)
+	if err == nil {
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		res.Body.Close()
+	}
+
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Error("Server did not shutdown after 1s")
+	}
+}
+
+func TestReadinessRestart(t *testing.T) {
+	srv := New()
+	srv.EnableHealth("/healthz", "/readyz")
+
+	result := make(chan error)
+	go func() {
+		result <- srv.Run("127.0.0.1:8775", ShutdownDelay(time.Second))
+	}()
+
+	<-time.After(100 * time.Millisecond)
+
+	// no readiness failure and shutdown delay after a graceful restart
+	srv.quit <- restartedSignal{}
+
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(500 * time.Millisecond):
+		t.Error("Server did not shutdown without the delay")
+	}
+
+	assert.Equal(t, int32(0), atomic.LoadInt32(&srv.shuttingDown))
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// limitListener is a net.Listener accepting connections only if the shared semaphore has capacity.
+type limitListener struct {
+	net.Listener
+	sem       chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newLimitListener returns a limitListener for ln using the semaphore sem.
+// The semaphore can be shared to limit the connections of multiple listeners.
+func newLimitListener(ln net.Listener, sem chan struct{}) *limitListener {
+	return &limitListener{
+		Listener: ln,
+		sem:      sem,
+		done:     make(chan struct{}),
+	}
+}
+
+// Accept waits until the connection limit allows a new connection and returns the next connection.
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+
+	c, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+
+	return &limitConn{Conn: c, sem: l.sem}, nil
+}
+
+// Close closes the listener and stops waiting for capacity.
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+
+	return l.Listener.Close()
+}
+
+// limitConn is a net.Conn releasing its semaphore slot on close.
+type limitConn struct {
+	net.Conn
+	sem         chan struct{}
+	releaseOnce sync.Once
+}
+
+// Close closes the connection and releases the semaphore slot.
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+
+	c.releaseOnce.Do(func() {
+		<-c.sem
+	})
+
+	return err
+}
+
+// ShedRequests returns the number of requests rejected because of the MaxInFlight limit.
+func (s *Server) ShedRequests() uint64 {
+	return atomic.LoadUint64(&s.shedRequests)
+}
+
+// acquireInFlight reserves an in-flight request slot.
+// Returns false and counts the shed request if the MaxInFlight limit is reached.
+func (s *Server) acquireInFlight() bool {
+	if atomic.AddInt64(&s.inFlight, 1) > s.maxInFlight {
+		atomic.AddInt64(&s.inFlight, -1)
+		atomic.AddUint64(&s.shedRequests, 1)
+
+		return false
+	}
+
+	return true
+}
+
+// releaseInFlight releases an in-flight request slot.
+func (s *Server) releaseInFlight() {
+	atomic.AddInt64(&s.inFlight, -1)
+}
+
+// shed responds with 503 to a request rejected because of the MaxInFlight limit.
+func shed(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	sem := make(chan struct{}, 1)
+	l := newLimitListener(ln, sem)
+
+	go func() {
+		c1, _ := net.Dial("tcp", ln.Addr().String())
+		c2, _ := net.Dial("tcp", ln.Addr().String())
+		defer c1.Close()
+		defer c2.Close()
+
+		<-time.After(500 * time.Millisecond)
+	}()
+
+	c, err := l.Accept()
+	assert.NoError(t, err)
+	assert.Len(t, sem, 1)
+
+	// the second connection is not accepted until the first is closed
+	accepted := make(chan net.Conn)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+
+	select {
+	case <-accepted:
+		t.Error("connection accepted above the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.Close()
+	c.Close()
+
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(time.Second):
+		t.Error("connection not accepted after close")
+	}
+
+	assert.Len(t, sem, 0)
+
+	// closing the listener stops waiting for capacity
+	sem <- struct{}{}
+	result := make(chan error)
+	go func() {
+		_, err := l.Accept()
+		result <- err
+	}()
+
+	<-time.After(10 * time.Millisecond)
+	l.Close()
+	assert.Equal(t, net.ErrClosed, <-result)
+}
+
+func TestMaxInFlight(t *testing.T) {
+	srv := New()
+
+	start := make(chan bool)
+	release := make(chan bool)
+	srv.GET("/", func(w http.ResponseWriter, r *http.Request) {
+		start <- true
+		<-release
+		w.Write([]byte("ok"))
+	})
+
+	srv.maxInFlight = 1
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		assert.Equal(t, "ok", w.Body.String())
+	}()
+
+	<-start
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, uint64(1), srv.ShedRequests())
+
+	close(release)
+	wg.Wait()
+
+	go func() { <-start }()
+
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, uint64(1), srv.ShedRequests())
+}
+
+func TestMaxInFlightHealth(t *testing.T) {
+	srv := New()
+	srv.EnableHealth("/healthz", "/readyz")
+
+	srv.maxInFlight = 1
+	srv.inFlight = 1
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+
+	assert.Equal(t, uint64(0), srv.ShedRequests())
+	assert.Equal(t, int64(1), srv.inFlight)
+
+	req, _ := http.NewRequest("POST", "/healthz", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestRunMaxConnections(t *testing.T) {
+	srv := New()
+	srv.GET("/", routeHandler)
+
+	result := make(chan error)
+	go func() {
+		result <- srv.Run("127.0.0.1:8774", MaxConnections(1), MaxInFlight(10))
+	}()
+
+	<-time.After(100 * time.Millisecond)
+
+	// the idle keep-alive connection blocks the second one
+	c1, err := net.Dial("tcp", "127.0.0.1:8774")
+	assert.NoError(t, err)
+
+	client := &http.Client{Timeout: 100 * time.Millisecond}
+	_, err = client.Get("http://127.0.0.1:8774/")
+	assert.Error(t, err)
+
+	c1.Close()
+
+	client = &http.Client{Timeout: time.Second}
+	res, err := client.Get("http://127.0.0.1:8774/")
+	assert.NoError(t, err)
+	if err == nil {
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		res.Body.Close()
+	}
+
+	srv.quit <- os.Interrupt
+
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+		assert.Equal(t, int64(10), srv.maxInFlight)
+	case <-time.After(time.Second):
+		t.Error("Server did not shutdown after 1s")
+	}
+}
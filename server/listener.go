@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Listener defines an address the server listens on.
+type Listener struct {
+	// Addr is the tcp address to listen on, defaults to ":http" or ":https".
+	Addr string
+
+	// CertFile and KeyFile enable https for the listener.
+	CertFile string
+	KeyFile  string
+
+	// CertDir enables https for the listener with all certificates of the directory (see NewCertificateDirLoader).
+	CertDir string
+
+	// TLS enables https for the listener with the certificates of the TLSConfig option.
+	TLS bool
+
+	// RedirectHTTPS answers all requests with a 308 redirect to the https listener instead of serving the routes.
+	RedirectHTTPS bool
+}
+
+// isTLS returns whether the listener serves https.
+func (l Listener) isTLS() bool {
+	return l.TLS || l.hasCertificateFiles()
+}
+
+// hasCertificateFiles returns whether the listener loads the certificates from files.
+func (l Listener) hasCertificateFiles() bool {
+	return (l.CertFile != "" && l.KeyFile != "") || l.CertDir != ""
+}
+
+// certificateLoader returns the CertificateLoader for the certificates of the listener.
+func (l Listener) certificateLoader() (*CertificateLoader, error) {
+	if l.CertDir != "" {
+		return NewCertificateDirLoader(l.CertDir)
+	}
+
+	return NewCertificateLoader(l.CertFile, l.KeyFile)
+}
+
+// address returns the listener address with the default port if no address is set.
+func (l Listener) address() string {
+	if l.Addr != "" {
+		return l.Addr
+	}
+
+	if l.isTLS() {
+		return ":https"
+	}
+
+	return ":http"
+}
+
+// httpsPort returns the port of the first https listener, defaults to 443.
+func httpsPort(listeners []Listener) string {
+	for _, l := range listeners {
+		if !l.isTLS() {
+			continue
+		}
+
+		_, port, err := net.SplitHostPort(l.address())
+		if err != nil || port == "https" {
+			break
+		}
+
+		return port
+	}
+
+	return "443"
+}
+
+// createRedirectHTTPSHandler returns the http handler redirecting all requests to https on the given port.
+func createRedirectHTTPSHandler(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// newRedirectServer returns a http.Server with the timeouts and limits of srv and the given handler.
+func newRedirectServer(srv *http.Server, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadTimeout:       srv.ReadTimeout,
+		ReadHeaderTimeout: srv.ReadHeaderTimeout,
+		WriteTimeout:      srv.WriteTimeout,
+		IdleTimeout:       srv.IdleTimeout,
+		MaxHeaderBytes:    srv.MaxHeaderBytes,
+		ErrorLog:          srv.ErrorLog,
+	}
+}
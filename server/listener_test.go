@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenerAddress(t *testing.T) {
+	assert.Equal(t, ":http", Listener{}.address())
+	assert.Equal(t, ":https", Listener{CertFile: "cert.pem", KeyFile: "key.pem"}.address())
+	assert.Equal(t, ":8080", Listener{Addr: ":8080"}.address())
+}
+
+func TestHTTPSPort(t *testing.T) {
+	assert.Equal(t, "443", httpsPort(nil))
+	assert.Equal(t, "443", httpsPort([]Listener{{Addr: ":80"}, {CertFile: "cert.pem", KeyFile: "key.pem"}}))
+	assert.Equal(t, "8443", httpsPort([]Listener{{Addr: ":80"}, {Addr: ":8443", CertFile: "cert.pem", KeyFile: "key.pem"}}))
+}
+
+func TestRedirectHTTPSHandler(t *testing.T) {
+	tests := []struct {
+		port     string
+		host     string
+		uri      string
+		location string
+	}{
+		{"443", "example.com", "/path?q=1", "https://example.com/path?q=1"},
+		{"443", "example.com:80", "/", "https://example.com/"},
+		{"8443", "example.com:8080", "/path", "https://example.com:8443/path"},
+		{"443", "[::1]:80", "/", "https://[::1]/"},
+		{"443", "[::1]", "/", "https://[::1]/"},
+		{"8443", "[::1]", "/", "https://[::1]:8443/"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", test.uri, nil)
+		req.Host = test.host
+		w := httptest.NewRecorder()
+
+		createRedirectHTTPSHandler(test.port).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+		assert.Equal(t, test.location, w.Header().Get("Location"))
+	}
+}
+
+func TestRunMultiErrors(t *testing.T) {
+	srv := New()
+	assert.EqualError(t, srv.RunMulti(nil), "no listeners defined")
+
+	err := srv.RunMulti([]Listener{{Addr: ":8443", CertFile: "cert.pem", KeyFile: "key.pem", RedirectHTTPS: true}})
+	assert.EqualError(t, err, "listener ':8443' can not use tls and redirect to https")
+
+	err = srv.RunMulti([]Listener{{Addr: "127.0.0.1:8768"}, {Addr: ":1000000000"}})
+	assert.Error(t, err)
+}
+
+func TestRunMultiServeError(t *testing.T) {
+	srv := New()
+
+	result := make(chan error)
+	go func() {
+		result <- srv.RunMulti([]Listener{{Addr: "127.0.0.1:8768"}, {Addr: "127.0.0.1:8769", CertFile: "missing.pem", KeyFile: "missing.pem"}})
+	}()
+
+	select {
+	case err := <-result:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Error("RunMulti did not return after 1s")
+	}
+}
+
+func TestRunMulti(t *testing.T) {
+	srv := New()
+	srv.GET("/", routeHandler)
+
+	result := make(chan error)
+	go func() {
+		result <- srv.RunMulti([]Listener{{Addr: "127.0.0.1:8766"}, {Addr: "127.0.0.1:8767", RedirectHTTPS: true}})
+	}()
+
+	<-time.After(100 * time.Millisecond)
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	res, err := client.Get("http://127.0.0.1:8766/")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res.Body.Close()
+
+	res, err = client.Get("http://127.0.0.1:8767/path")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPermanentRedirect, res.StatusCode)
+	assert.Equal(t, "https://127.0.0.1/path", res.Header.Get("Location"))
+	res.Body.Close()
+
+	srv.quit <- os.Interrupt
+
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Error("Server did not shutdown after 1s")
+	}
+}
@@ -17,6 +17,7 @@ type node struct {
 	isDynamic  bool
 	isMatchAll bool
 	fn         http.Handler
+	pattern    string
 }
 
 // add adds a new node with a given path.
@@ -24,6 +25,7 @@ func (n *node) add(path string, fn http.Handler) {
 	if path == "/" {
 		n.path = "/"
 		n.fn = fn
+		n.pattern = path
 		return
 	}
 
@@ -83,6 +85,7 @@ func (n *node) add(path string, fn http.Handler) {
 	}
 
 	resolvedNode.fn = fn
+	resolvedNode.pattern = path
 }
 
 // resolve returns the node and the request with context for a given request.
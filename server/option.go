@@ -1,14 +1,91 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
+	"log"
+	"net"
 	"net/http"
+	"os"
+	"sync"
 	"time"
 )
 
 // Option is a function type to modify the `http.Server` configuration.
 type Option func(*http.Server)
 
+// config is the run configuration, the settings which are not part of the `http.Server` (see configOf).
+type config struct {
+	srv *http.Server
+
+	restartSignal             os.Signal
+	certificateReloadInterval time.Duration
+
+	devCertificate *devCertificate
+	devCAFile      string
+
+	h2c bool
+
+	shutdownDelay time.Duration
+
+	maxConnections int
+	maxInFlight    int
+}
+
+// newConfig returns a config with the default `http.Server` configuration.
+func newConfig(options []Option) *config {
+	c := &config{
+		srv: &http.Server{
+			ReadHeaderTimeout: 5 * time.Second,
+			IdleTimeout:       120 * time.Second,
+		},
+		certificateReloadInterval: time.Minute,
+	}
+
+	configs.Lock()
+	configs.m[c.srv] = c
+	configs.Unlock()
+
+	for _, option := range options {
+		option(c.srv)
+	}
+
+	configs.Lock()
+	delete(configs.m, c.srv)
+	configs.Unlock()
+
+	return c
+}
+
+// configs holds the run configurations of the `http.Server`s while newConfig applies the options.
+var configs = struct {
+	sync.Mutex
+	m map[*http.Server]*config
+}{m: map[*http.Server]*config{}}
+
+// configOf returns the run configuration of the `http.Server` the options are applied to.
+// Options applied to another `http.Server` get a configuration which is discarded.
+func configOf(srv *http.Server) *config {
+	configs.Lock()
+	defer configs.Unlock()
+
+	if c, ok := configs.m[srv]; ok {
+		return c
+	}
+
+	return &config{srv: srv}
+}
+
+// logf logs the message using the `http.Server`.`ErrorLog` or the standard logger.
+func (c *config) logf(format string, args ...interface{}) {
+	if c.srv.ErrorLog != nil {
+		c.srv.ErrorLog.Printf(format, args...)
+		return
+	}
+
+	log.Printf(format, args...)
+}
+
 // ReadHeaderTimeout returns an Option for setting the `http.Server`.`ReadHeaderTimeout`
 func ReadHeaderTimeout(d time.Duration) Option {
 	return func(srv *http.Server) {
@@ -23,6 +100,13 @@ func IdleTimeout(d time.Duration) Option {
 	}
 }
 
+// ReadTimeout returns an Option for setting the `http.Server`.`ReadTimeout`
+func ReadTimeout(d time.Duration) Option {
+	return func(srv *http.Server) {
+		srv.ReadTimeout = d
+	}
+}
+
 // WriteTimeout returns an Option for setting the `http.Server`.`WriteTimeout`
 func WriteTimeout(d time.Duration) Option {
 	return func(srv *http.Server) {
@@ -30,9 +114,122 @@ func WriteTimeout(d time.Duration) Option {
 	}
 }
 
+// MaxHeaderBytes returns an Option for setting the `http.Server`.`MaxHeaderBytes`
+func MaxHeaderBytes(n int) Option {
+	return func(srv *http.Server) {
+		srv.MaxHeaderBytes = n
+	}
+}
+
+// ErrorLog returns an Option for setting the `http.Server`.`ErrorLog`
+func ErrorLog(l *log.Logger) Option {
+	return func(srv *http.Server) {
+		srv.ErrorLog = l
+	}
+}
+
+// ConnState returns an Option for setting the `http.Server`.`ConnState`
+func ConnState(fn func(net.Conn, http.ConnState)) Option {
+	return func(srv *http.Server) {
+		srv.ConnState = fn
+	}
+}
+
+// BaseContext returns an Option for setting the `http.Server`.`BaseContext`
+func BaseContext(fn func(net.Listener) context.Context) Option {
+	return func(srv *http.Server) {
+		srv.BaseContext = fn
+	}
+}
+
+// ConnContext returns an Option for setting the `http.Server`.`ConnContext`
+func ConnContext(fn func(ctx context.Context, c net.Conn) context.Context) Option {
+	return func(srv *http.Server) {
+		srv.ConnContext = fn
+	}
+}
+
+// KeepAlives returns an Option for enabling or disabling the HTTP keep-alives (see `http.Server`.`SetKeepAlivesEnabled`).
+// Keep-alives are enabled by default.
+func KeepAlives(enabled bool) Option {
+	return func(srv *http.Server) {
+		srv.SetKeepAlivesEnabled(enabled)
+	}
+}
+
 // TLSConfig returns an Option for setting the `http.Server`.`TLSConfig`
 func TLSConfig(c *tls.Config) Option {
 	return func(srv *http.Server) {
 		srv.TLSConfig = c
 	}
 }
+
+// GracefulRestart returns an Option for enabling the zero-downtime restart on the given signal (e.g. syscall.SIGUSR2).
+// The process re-executes itself and passes the listening sockets to the child.
+// The server is shut down gracefully as soon as the child is ready to accept connections.
+func GracefulRestart(sig os.Signal) Option {
+	return func(srv *http.Server) {
+		configOf(srv).restartSignal = sig
+	}
+}
+
+// CertificateReloadInterval returns an Option for setting the interval the certificate files are checked for modifications.
+// Defaults to 1 minute, 0 disables the check. The certificates are always reloaded on SIGHUP.
+func CertificateReloadInterval(d time.Duration) Option {
+	return func(srv *http.Server) {
+		configOf(srv).certificateReloadInterval = d
+	}
+}
+
+// DevCAFile returns an Option for writing the generated CA certificate of `RunTLSDev` as PEM to the given path.
+func DevCAFile(path string) Option {
+	return func(srv *http.Server) {
+		configOf(srv).devCAFile = path
+	}
+}
+
+// devCertificateOption returns an Option for setting the generated development certificate as `http.Server`.`TLSConfig` certificate.
+func devCertificateOption(dev *devCertificate) Option {
+	return func(srv *http.Server) {
+		if srv.TLSConfig == nil {
+			srv.TLSConfig = &tls.Config{}
+		} else {
+			srv.TLSConfig = srv.TLSConfig.Clone()
+		}
+
+		srv.TLSConfig.Certificates = []tls.Certificate{dev.certificate}
+		configOf(srv).devCertificate = dev
+	}
+}
+
+// H2C returns an Option for enabling HTTP/2 over cleartext (prior knowledge and `Upgrade: h2c`) on the plain listeners.
+func H2C() Option {
+	return func(srv *http.Server) {
+		configOf(srv).h2c = true
+	}
+}
+
+// ShutdownDelay returns an Option for setting the delay between the start of the graceful shutdown and closing the listeners.
+// The readiness endpoint (see `Server`.`EnableHealth`) responds with 503 during the delay to let load balancers stop routing traffic.
+// The delay is skipped after a graceful restart, the restarted process keeps accepting connections on the same sockets.
+func ShutdownDelay(d time.Duration) Option {
+	return func(srv *http.Server) {
+		configOf(srv).shutdownDelay = d
+	}
+}
+
+// MaxConnections returns an Option for limiting the concurrent accepted connections of all listeners.
+// New connections wait in the listen backlog until a connection is closed.
+func MaxConnections(n int) Option {
+	return func(srv *http.Server) {
+		configOf(srv).maxConnections = n
+	}
+}
+
+// MaxInFlight returns an Option for limiting the concurrently handled requests.
+// Excess requests are rejected with 503 and a Retry-After header (see `Server`.`ShedRequests`).
+func MaxInFlight(n int) Option {
+	return func(srv *http.Server) {
+		configOf(srv).maxInFlight = n
+	}
+}
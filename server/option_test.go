@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewConfigDefaults(t *testing.T) {
+	cfg := newConfig(nil)
+
+	assert.Equal(t, 5*time.Second, cfg.srv.ReadHeaderTimeout)
+	assert.Equal(t, 120*time.Second, cfg.srv.IdleTimeout)
+	assert.Equal(t, time.Minute, cfg.certificateReloadInterval)
+}
+
+func TestServerOptions(t *testing.T) {
+	logger := log.New(os.Stderr, "", 0)
+	ctx := context.WithValue(context.Background(), routeParamsContextKey, "base")
+
+	cfg := newConfig([]Option{
+		ReadTimeout(1 * time.Second),
+		MaxHeaderBytes(1024),
+		ErrorLog(logger),
+		ConnState(func(net.Conn, http.ConnState) {}),
+		BaseContext(func(net.Listener) context.Context { return ctx }),
+		ConnContext(func(ctx context.Context, c net.Conn) context.Context { return ctx }),
+		KeepAlives(false),
+		H2C(),
+		ShutdownDelay(2 * time.Second),
+		CertificateReloadInterval(0),
+	})
+
+	assert.Equal(t, 1*time.Second, cfg.srv.ReadTimeout)
+	assert.Equal(t, 1024, cfg.srv.MaxHeaderBytes)
+	assert.Equal(t, logger, cfg.srv.ErrorLog)
+	assert.NotNil(t, cfg.srv.ConnState)
+	assert.Equal(t, ctx, cfg.srv.BaseContext(nil))
+	assert.NotNil(t, cfg.srv.ConnContext)
+	assert.True(t, cfg.h2c)
+	assert.Equal(t, 2*time.Second, cfg.shutdownDelay)
+	assert.Equal(t, time.Duration(0), cfg.certificateReloadInterval)
+}
+
+func TestCustomOption(t *testing.T) {
+	custom := func(srv *http.Server) {
+		srv.WriteTimeout = 3 * time.Second
+	}
+
+	cfg := newConfig([]Option{custom, MaxInFlight(10)})
+	assert.Equal(t, 3*time.Second, cfg.srv.WriteTimeout)
+	assert.Equal(t, 10, cfg.maxInFlight)
+	assert.Len(t, configs.m, 0)
+
+	// server options applied to another http.Server
+	srv := &http.Server{}
+	ReadTimeout(time.Second)(srv)
+	MaxInFlight(10)(srv)
+	assert.Equal(t, time.Second, srv.ReadTimeout)
+}
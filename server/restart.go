@@ -0,0 +1,277 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+)
+
+// restartListenersEnv is the environment variable containing the addresses of the listeners passed to a restarted process.
+const restartListenersEnv = "FABYSCORE_RESTART_LISTENERS"
+
+// restartFDStart is the first file descriptor of the files passed with `exec.Cmd`.`ExtraFiles`.
+const restartFDStart = 3
+
+// restartReadyTimeout is the duration the parent process waits for the restarted process to become ready.
+var restartReadyTimeout = 30 * time.Second
+
+var osNewFile = os.NewFile
+var netFileListener = net.FileListener
+var execCommand = exec.Command
+
+// inherited holds the listeners and the ready notification file passed by the parent process.
+// err is the error of loading the listeners, it is returned by every listen call.
+var inherited struct {
+	once      sync.Once
+	mu        sync.Mutex
+	listeners map[string]net.Listener
+	ready     *os.File
+	err       error
+}
+
+// addrListener is a listener with the address it was created for.
+type addrListener struct {
+	addr string
+	net.Listener
+}
+
+// listen returns the listener inherited from the parent process for the given addr or creates a new tcp listener.
+func listen(addr string) (net.Listener, error) {
+	inherited.once.Do(func() {
+		addrs := os.Getenv(restartListenersEnv)
+		if addrs == "" {
+			return
+		}
+
+		os.Unsetenv(restartListenersEnv)
+
+		listeners, ready, err := loadInheritedListeners(addrs, restartFDStart)
+		if err != nil {
+			inherited.err = fmt.Errorf("loading the inherited listeners failed: %v", err)
+			return
+		}
+
+		inherited.listeners = listeners
+		inherited.ready = ready
+	})
+
+	inherited.mu.Lock()
+	if inherited.err != nil {
+		inherited.mu.Unlock()
+		return nil, inherited.err
+	}
+
+	ln, found := inherited.listeners[addr]
+	if found {
+		delete(inherited.listeners, addr)
+	}
+	inherited.mu.Unlock()
+
+	if found {
+		return ln, nil
+	}
+
+	return net.Listen("tcp", addr)
+}
+
+// loadInheritedListeners creates the listeners for the comma separated addrs from the file descriptors starting at fd.
+// The file descriptor following the listeners is returned as ready notification file.
+// The already created listeners are closed if a listener fails.
+func loadInheritedListeners(addrs string, fd uintptr) (map[string]net.Listener, *os.File, error) {
+	listeners := map[string]net.Listener{}
+
+	fail := func(err error) (map[string]net.Listener, *os.File, error) {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+
+		return nil, nil, err
+	}
+
+	for _, addr := range strings.Split(addrs, ",") {
+		f := osNewFile(fd, "listener:"+addr)
+		if f == nil {
+			return fail(fmt.Errorf("inherited listener for '%s' not found", addr))
+		}
+
+		ln, err := netFileListener(f)
+		f.Close()
+		if err != nil {
+			return fail(err)
+		}
+
+		listeners[addr] = ln
+		fd++
+	}
+
+	return listeners, osNewFile(fd, "restart-ready"), nil
+}
+
+// notifyRestartReady notifies the parent process that all inherited listeners are in use.
+// Does nothing if the process was not started by a graceful restart.
+func notifyRestartReady() {
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+
+	if inherited.ready == nil || len(inherited.listeners) != 0 {
+		return
+	}
+
+	inherited.ready.Write([]byte{1})
+	inherited.ready.Close()
+	inherited.ready = nil
+}
+
+// restartedSignal is sent to quit after the restarted process is ready.
+type restartedSignal struct{}
+
+func (restartedSignal) String() string { return "restarted" }
+func (restartedSignal) Signal()        {}
+
+// watchRestart restarts the process with the given listeners if the restart signal is received.
+// The server is shut down gracefully after the restarted process is ready.
+// Closing the returned channel stops the watcher.
+func (s *Server) watchRestart(cfg *config, listeners []addrListener) chan bool {
+	stop := make(chan bool)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, cfg.restartSignal)
+
+	go func() {
+		defer signal.Stop(sig)
+
+		for {
+			select {
+			case <-sig:
+				if err := restartProcess(listeners); err != nil {
+					cfg.logf("server: graceful restart failed: %v", err)
+					continue
+				}
+
+				select {
+				case s.quit <- restartedSignal{}:
+				default:
+				}
+
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return stop
+}
+
+// restartProcess starts a new process of the current executable with the given listeners.
+// Blocks until the new process is ready or failed.
+func restartProcess(listeners []addrListener) error {
+	files := make([]*os.File, 0, len(listeners)+1)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	addrs := make([]string, 0, len(listeners))
+	for _, ln := range listeners {
+		fl, ok := ln.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("listener for '%s' does not support file descriptors", ln.addr)
+		}
+
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+
+		files = append(files, f)
+		addrs = append(addrs, ln.addr)
+	}
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+
+	files = append(files, readyWriter)
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := execCommand(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(restartEnv(os.Environ()), restartListenersEnv+"="+strings.Join(addrs, ","))
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// the child holds its own copy of the write end, closing ours lets the read fail if the child exits
+	readyWriter.Close()
+	files = files[:len(files)-1]
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	if err := waitForReady(ready, restartReadyTimeout); err != nil {
+		// a process becoming ready too late would accept connections on the inherited sockets next to this process
+		cmd.Process.Kill()
+		<-exited
+
+		return err
+	}
+
+	return nil
+}
+
+// waitForReady waits until the ready notification is received from r.
+func waitForReady(r io.Reader, timeout time.Duration) error {
+	result := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		if _, err := r.Read(b); err != nil {
+			result <- errors.New("restarted process exited before it was ready")
+			return
+		}
+
+		result <- nil
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		return errors.New("restarted process did not become ready in time")
+	}
+}
+
+// restartEnv returns the environment without the restart variables.
+func restartEnv(env []string) []string {
+	filtered := make([]string, 0, len(env))
+	for _, e := range env {
+		if strings.HasPrefix(e, restartListenersEnv+"=") {
+			continue
+		}
+
+		filtered = append(filtered, e)
+	}
+
+	return filtered
+}
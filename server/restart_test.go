@@ -0,0 +1,213 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenInherited(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	inherited.once.Do(func() {})
+	inherited.mu.Lock()
+	inherited.listeners = map[string]net.Listener{":9999": ln}
+	inherited.mu.Unlock()
+
+	l, err := listen(":9999")
+	assert.NoError(t, err)
+	assert.Equal(t, ln, l)
+	assert.Len(t, inherited.listeners, 0)
+}
+
+func TestLoadInheritedListeners(t *testing.T) {
+	defer func() {
+		osNewFile = os.NewFile
+	}()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	f, err := ln.(*net.TCPListener).File()
+	assert.NoError(t, err)
+
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	defer r.Close()
+
+	files := map[uintptr]*os.File{3: f, 4: w}
+	osNewFile = func(fd uintptr, name string) *os.File {
+		return files[fd]
+	}
+
+	listeners, ready, err := loadInheritedListeners(":8080", 3)
+	assert.NoError(t, err)
+	assert.Len(t, listeners, 1)
+	assert.Equal(t, w, ready)
+	assert.Equal(t, ln.Addr().String(), listeners[":8080"].Addr().String())
+	listeners[":8080"].Close()
+	w.Close()
+
+	_, _, err = loadInheritedListeners(":8080,:8081", 5)
+	assert.EqualError(t, err, "inherited listener for ':8080' not found")
+}
+
+func TestLoadInheritedListenersClosesListenersOnError(t *testing.T) {
+	defer func() {
+		osNewFile = os.NewFile
+		netFileListener = net.FileListener
+	}()
+
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	defer r.Close()
+	defer w.Close()
+
+	osNewFile = func(fd uintptr, name string) *os.File {
+		if fd == 3 {
+			return r
+		}
+
+		return w
+	}
+
+	created := []*closeRecordingListener{}
+	netFileListener = func(f *os.File) (net.Listener, error) {
+		if f == w {
+			return nil, errors.New("not a listener")
+		}
+
+		ln := &closeRecordingListener{}
+		created = append(created, ln)
+
+		return ln, nil
+	}
+
+	_, _, err = loadInheritedListeners(":8080,:8081", 3)
+	assert.EqualError(t, err, "not a listener")
+	assert.Len(t, created, 1)
+	assert.True(t, created[0].closed)
+}
+
+func TestListenInheritedError(t *testing.T) {
+	defer func() {
+		osNewFile = os.NewFile
+		inherited.once = sync.Once{}
+		inherited.err = nil
+	}()
+
+	osNewFile = func(fd uintptr, name string) *os.File { return nil }
+	os.Setenv(restartListenersEnv, ":8080")
+	inherited.once = sync.Once{}
+
+	_, err := listen(":8080")
+	assert.EqualError(t, err, "loading the inherited listeners failed: inherited listener for ':8080' not found")
+
+	_, err = listen("127.0.0.1:0")
+	assert.Error(t, err)
+}
+
+func TestNotifyRestartReady(t *testing.T) {
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	defer r.Close()
+
+	inherited.mu.Lock()
+	inherited.listeners = map[string]net.Listener{}
+	inherited.ready = w
+	inherited.mu.Unlock()
+
+	notifyRestartReady()
+	assert.Nil(t, inherited.ready)
+	assert.NoError(t, waitForReady(r, time.Second))
+
+	// not ready without the file
+	notifyRestartReady()
+}
+
+func TestWaitForReady(t *testing.T) {
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	w.Close()
+
+	assert.EqualError(t, waitForReady(r, time.Second), "restarted process exited before it was ready")
+	r.Close()
+
+	r, w, err = os.Pipe()
+	assert.NoError(t, err)
+	defer r.Close()
+	defer w.Close()
+
+	assert.EqualError(t, waitForReady(r, 10*time.Millisecond), "restarted process did not become ready in time")
+}
+
+func TestRestartProcessUnsupportedListener(t *testing.T) {
+	err := restartProcess([]addrListener{{addr: ":8080", Listener: unsupportedListener{}}})
+	assert.EqualError(t, err, "listener for ':8080' does not support file descriptors")
+}
+
+func TestRestartProcessNotReadyKillsProcess(t *testing.T) {
+	defer func() {
+		execCommand = exec.Command
+		restartReadyTimeout = 30 * time.Second
+	}()
+
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep not found")
+	}
+
+	var cmd *exec.Cmd
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		cmd = exec.Command(sleep, "10")
+		return cmd
+	}
+	restartReadyTimeout = 50 * time.Millisecond
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	start := time.Now()
+	err = restartProcess([]addrListener{{addr: ":8080", Listener: ln}})
+	assert.EqualError(t, err, "restarted process did not become ready in time")
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	// the process was killed and waited for
+	assert.NotNil(t, cmd.ProcessState)
+	assert.False(t, cmd.ProcessState.Success())
+}
+
+func TestRestartEnv(t *testing.T) {
+	env := restartEnv([]string{"A=1", restartListenersEnv + "=:8080", "B=2"})
+	assert.Equal(t, []string{"A=1", "B=2"}, env)
+}
+
+func TestGracefulRestartOption(t *testing.T) {
+	cfg := newConfig([]Option{GracefulRestart(os.Interrupt)})
+	assert.Equal(t, os.Interrupt, cfg.restartSignal)
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+type unsupportedListener struct {
+	net.Listener
+}
+
+type closeRecordingListener struct {
+	net.Listener
+	closed bool
+}
+
+func (l *closeRecordingListener) Close() error {
+	l.closed = true
+	return nil
+}
@@ -8,6 +8,7 @@ var routeParamsContextKey = &ContextKey{"route-params"}
 // routeParams holds the dynamic / match all params from the url path.
 type routeParams struct {
 	paramsKeys, paramsValues []string
+	pattern                  string
 }
 
 // newRouteParams creates a new routeParams object.
@@ -19,6 +20,7 @@ func newRouteParams() *routeParams {
 func (rp *routeParams) Reset() {
 	rp.paramsKeys = rp.paramsKeys[:0]
 	rp.paramsValues = rp.paramsValues[:0]
+	rp.pattern = ""
 }
 
 // Add adds a new param.
@@ -0,0 +1,21 @@
+package server
+
+import "net/http"
+
+// routePatternContextKey context key for the matched route pattern of requests without route params (e.g. the automatic OPTIONS response).
+var routePatternContextKey = &ContextKey{"route-pattern"}
+
+// RoutePattern returns the pattern of the matched route (e.g. /users/:id) or an empty string.
+// Use the pattern instead of the raw path for low cardinality labels (e.g. metrics, tracing).
+func RoutePattern(r *http.Request) string {
+	ctx := r.Context()
+	if pattern, ok := ctx.Value(routePatternContextKey).(string); ok {
+		return pattern
+	}
+
+	if params, ok := ctx.Value(routeParamsContextKey).(*routeParams); ok {
+		return params.pattern
+	}
+
+	return ""
+}
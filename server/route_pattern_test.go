@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutePattern(t *testing.T) {
+	srv := New()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(RoutePattern(r)))
+	}
+
+	srv.GET("/", handler)
+	srv.GET("/users/:id", handler)
+	srv.GET("/files/*path", handler)
+	srv.Group("/api", func(g *Group) {
+		g.GET("/status", handler)
+	})
+
+	tests := map[string]string{
+		"/":              "/",
+		"/users/1":       "/users/:id",
+		"/files/a/b.txt": "/files/*path",
+		"/api/status":    "/api/status",
+	}
+
+	for path, pattern := range tests {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		assert.Equal(t, pattern, w.Body.String(), path)
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	assert.Equal(t, "", RoutePattern(req))
+}
+
+func TestRoutePatternRewrittenPath(t *testing.T) {
+	srv := New()
+
+	rewrite := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.URL.Path = "/rewritten" + r.URL.Path
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(RoutePattern(r)))
+	}
+
+	srv.GET("/status", handler, rewrite)
+
+	req, _ := http.NewRequest("GET", "/status", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, "/status", w.Body.String())
+}
+
+func TestRoutePatternNotPath(t *testing.T) {
+	srv := New()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(RoutePattern(r)))
+	}
+
+	srv.GET("/status", handler)
+	srv.GET("/slash/", handler)
+	srv.GET("/items/:id", handler)
+	srv.SetNotFoundHandler(handler)
+
+	tests := map[string]string{
+		"/status/": "/status",
+		"/slash":   "/slash/",
+		"/items":   "/items/:id",
+		"/missing": "",
+	}
+
+	for path, pattern := range tests {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		assert.Equal(t, pattern, w.Body.String(), path)
+	}
+
+	// a static route path requested with another method is not matched
+	req, _ := http.NewRequest("POST", "/status", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	assert.Equal(t, "", w.Body.String())
+}
+
+func TestRoutePatternParamsReset(t *testing.T) {
+	params := newRouteParams()
+	params.Add("id", "1")
+	params.pattern = "/users/:id"
+	params.Reset()
+
+	assert.Equal(t, "", params.pattern)
+}
+
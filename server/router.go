@@ -68,6 +68,11 @@ func (r *router) resolve(req *http.Request) (*node, *http.Request, *routeParams)
 	return root.resolve(req, r.pool)
 }
 
+// getParams returns a params object from the pool.
+func (r *router) getParams() *routeParams {
+	return r.pool.Get().(*routeParams)
+}
+
 // resetParams resets the params object and adds it back to the pool.
 func (r *router) resetParams(params *routeParams) {
 	if params == nil {
@@ -2,11 +2,17 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -16,9 +22,17 @@ import (
 type Server struct {
 	router          *router
 	notFoundHandler http.HandlerFunc
+	notFound        http.Handler
+	optionsHandler  http.Handler
 	middlewares     middlewares
+	health          health
 
-	quit chan os.Signal
+	quit         chan os.Signal
+	shuttingDown int32
+
+	maxInFlight  int64
+	inFlight     int64
+	shedRequests uint64
 }
 
 // New returns an Server instance.
@@ -37,33 +51,87 @@ func New() *Server {
 // Run starts a http.Server for the application with the given addr.
 // This method blocks the calling goroutine.
 func (s *Server) Run(addr string, options ...Option) error {
-	return s.run(addr, options, "", "")
+	return s.run([]Listener{{Addr: addr}}, options)
 }
 
 // RunTLS starts a https http.Server for the application with the given addr and certificate files.
 // This method blocks the calling goroutine.
 func (s *Server) RunTLS(addr, certFile, keyFile string, options ...Option) error {
-	return s.run(addr, options, certFile, keyFile)
+	return s.run([]Listener{{Addr: addr, CertFile: certFile, KeyFile: keyFile}}, options)
+}
+
+// RunTLSDev starts a https http.Server for local development with the given addr.
+// A self-signed CA and a certificate for localhost, 127.0.0.1 and ::1 are generated in memory on every start.
+// Use the DevCAFile option to write the CA certificate to disk to let browsers trust it.
+// This method blocks the calling goroutine.
+func (s *Server) RunTLSDev(addr string, options ...Option) error {
+	dev, err := generateDevCertificate("localhost", "127.0.0.1", "::1")
+	if err != nil {
+		return err
+	}
+
+	options = append(options, devCertificateOption(dev))
+
+	return s.run([]Listener{{Addr: addr, TLS: true}}, options)
+}
+
+// RunMulti starts the application on all given listeners with one coordinated graceful shutdown.
+// The shutdown is triggered for all listeners if one of them fails.
+// This method blocks the calling goroutine.
+func (s *Server) RunMulti(listeners []Listener, options ...Option) error {
+	return s.run(listeners, options)
 }
 
 // See http.Handler interface's ServeHTTP.
 func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// the health endpoints must respond under load, otherwise the orchestrator restarts busy instances
+	if s.maxInFlight > 0 && !s.health.isHealthRequest(req) {
+		if !s.acquireInFlight() {
+			shed(w)
+			return
+		}
+
+		defer s.releaseInFlight()
+	}
+
 	node, req, params := s.router.resolve(req)
 	if node == nil || node.fn == nil {
-		if s.notFoundHandler != nil {
-			s.notFoundHandler(w, req)
+		if req.Method == "OPTIONS" && s.serveAutomaticOptions(w, req) {
+			return
+		}
+
+		if s.notFound != nil {
+			s.notFound.ServeHTTP(w, req)
 		} else {
-			http.NotFound(w, req)
+			s.serveNotFound(w, req)
 		}
 
 		return
 	}
 
+	// the pooled params carry the route pattern, also for routes without params
+	if params == nil {
+		params = s.router.getParams()
+		req = req.WithContext(context.WithValue(req.Context(), routeParamsContextKey, params))
+	}
+
+	params.pattern = node.pattern
+
 	node.fn.ServeHTTP(w, req)
 
 	s.router.resetParams(params)
 }
 
+// serveNotFound is the http handler func for requests without a matching route.
+func (s *Server) serveNotFound(w http.ResponseWriter, req *http.Request) {
+	if s.notFoundHandler != nil {
+		s.notFoundHandler(w, req)
+		return
+	}
+
+	http.NotFound(w, req)
+}
+
 // GET adds a new request handler for a GET request with the given path.
 func (s *Server) GET(path string, fn http.HandlerFunc, middlewares ...MiddlewareFunc) {
 	s.addRoute("GET", path, fn, middlewares)
@@ -139,6 +207,7 @@ func (s *Server) Group(path string, fn GroupSetupFunc) {
 }
 
 // SetNotFoundHandler sets the http.HandlerFunc executed if no handler is found for the request.
+// The not found handler is executed with the server middlewares (e.g. to count the requests in the metrics).
 func (s *Server) SetNotFoundHandler(fn http.HandlerFunc) {
 	s.notFoundHandler = fn
 }
@@ -171,52 +240,202 @@ func (s *Server) ServeFiles(path string, root http.FileSystem, middlewares ...Mi
 	s.GET(strings.TrimSuffix(path, "/")+"/*file", createServeFilesHandler(root), middlewares...)
 }
 
-// run starts and creates the http.Server and does the graceful shutdown.
-func (s *Server) run(addr string, options []Option, certFile, keyFile string) error {
+// run starts and creates the http.Server for the listeners and does the graceful shutdown.
+func (s *Server) run(listeners []Listener, options []Option) error {
+	if len(listeners) == 0 {
+		return errors.New("no listeners defined")
+	}
+
+	for _, l := range listeners {
+		if l.RedirectHTTPS && l.isTLS() {
+			return errors.New("listener '" + l.address() + "' can not use tls and redirect to https")
+		}
+	}
+
 	// unset middlewares, they are only used during setup to create the final handler functions
 	s.middlewares = nil
 
 	// create http.Server
-	srv := &http.Server{
-		ReadHeaderTimeout: 5 * time.Second,
-		IdleTimeout:       120 * time.Second,
+	cfg := newConfig(options)
+
+	srv := cfg.srv
+	srv.Addr = listeners[0].Addr
+	srv.Handler = s
+
+	s.maxInFlight = int64(cfg.maxInFlight)
+
+	// http/2 over cleartext
+	var h2cHandler *h2cHandler
+	if cfg.h2c {
+		var err error
+		h2cHandler, err = newH2CHandler(srv, s)
+		if err != nil {
+			return err
+		}
+
+		srv.Handler = h2cHandler
 	}
 
-	for _, option := range options {
-		option(srv)
+	servers := []*http.Server{srv}
+
+	var redirectSrv *http.Server
+
+	// write the development CA
+	if cfg.devCertificate != nil && cfg.devCAFile != "" {
+		if err := ioutil.WriteFile(cfg.devCAFile, cfg.devCertificate.caPEM, 0644); err != nil {
+			return err
+		}
 	}
 
-	srv.Addr = addr
-	srv.Handler = s
+	// load certificates
+	loaders := make([]*CertificateLoader, len(listeners))
+	tlsLoaders := []*CertificateLoader{}
+	hasTLS := false
+	for i, l := range listeners {
+		if !l.isTLS() {
+			continue
+		}
+
+		hasTLS = true
+
+		if !l.hasCertificateFiles() {
+			if srv.TLSConfig == nil || (len(srv.TLSConfig.Certificates) == 0 && srv.TLSConfig.GetCertificate == nil) {
+				return errors.New("listener '" + l.address() + "' requires a certificate in the TLSConfig option")
+			}
+
+			continue
+		}
+
+		loader, err := l.certificateLoader()
+		if err != nil {
+			return err
+		}
+
+		loaders[i] = loader
+		tlsLoaders = append(tlsLoaders, loader)
+	}
+
+	if hasTLS {
+		prepareTLSConfig(srv)
+	}
+
+	// create listeners
+	lns := make([]addrListener, 0, len(listeners))
+	for _, l := range listeners {
+		ln, err := listen(l.address())
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+
+			return err
+		}
+
+		lns = append(lns, addrListener{addr: l.address(), Listener: ln})
+
+		if l.RedirectHTTPS && redirectSrv == nil {
+			redirectSrv = newRedirectServer(srv, createRedirectHTTPSHandler(httpsPort(listeners)))
+			servers = append(servers, redirectSrv)
+		}
+	}
 
 	// graceful shutdown
 	done := make(chan bool)
 	go func() {
-		<-s.quit
+		// let the readiness endpoint fail before the listeners are closed,
+		// not after a graceful restart, the restarted process accepts the connections on the same sockets
+		if sig := <-s.quit; sig != (restartedSignal{}) {
+			atomic.StoreInt32(&s.shuttingDown, 1)
+			if cfg.shutdownDelay > 0 {
+				time.Sleep(cfg.shutdownDelay)
+			}
+		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
-		srv.SetKeepAlivesEnabled(false)
-		srv.Shutdown(ctx)
+		var wg sync.WaitGroup
+		for _, srv := range servers {
+			wg.Add(1)
+			go func(srv *http.Server) {
+				defer wg.Done()
+
+				srv.SetKeepAlivesEnabled(false)
+				srv.Shutdown(ctx)
+			}(srv)
+		}
+
+		wg.Wait()
+
+		// the hijacked h2c connections are not tracked by the http.Server
+		if h2cHandler != nil {
+			h2cHandler.wait(ctx)
+		}
 
 		close(done)
 	}()
 
-	var err error
-	if certFile != "" && keyFile != "" {
-		err = srv.ListenAndServeTLS(certFile, keyFile)
-	} else {
-		err = srv.ListenAndServe()
+	// graceful restart
+	if cfg.restartSignal != nil {
+		stopRestart := s.watchRestart(cfg, lns)
+		defer close(stopRestart)
 	}
 
-	if err != http.ErrServerClosed {
-		close(done)
-		return err
+	// certificate reload
+	if len(tlsLoaders) > 0 {
+		stopReload := watchCertificates(cfg, tlsLoaders)
+		defer close(stopReload)
+	}
+
+	notifyRestartReady()
+
+	// serve
+	var connections chan struct{}
+	if cfg.maxConnections > 0 {
+		connections = make(chan struct{}, cfg.maxConnections)
+	}
+
+	errs := make(chan error, len(listeners))
+	for i, l := range listeners {
+		go func(l Listener, ln net.Listener, loader *CertificateLoader) {
+			if connections != nil {
+				ln = newLimitListener(ln, connections)
+			}
+
+			switch {
+			case l.RedirectHTTPS:
+				errs <- redirectSrv.Serve(ln)
+			case loader != nil:
+				errs <- srv.Serve(tls.NewListener(ln, listenerTLSConfig(srv, loader)))
+			case l.isTLS():
+				errs <- srv.Serve(tls.NewListener(ln, srv.TLSConfig))
+			default:
+				errs <- srv.Serve(ln)
+			}
+		}(l, lns[i].Listener, loaders[i])
+	}
+
+	var err error
+	for range listeners {
+		serveErr := <-errs
+		if serveErr == http.ErrServerClosed || err != nil {
+			continue
+		}
+
+		// stop all listeners if one failed
+		err = serveErr
+		for _, ln := range lns {
+			ln.Close()
+		}
+
+		select {
+		case s.quit <- os.Interrupt:
+		default:
+		}
 	}
 
 	<-done
-	return nil
+	return err
 }
 
 // addRoute adds a route to the router with the middleware aware handler.
@@ -234,7 +453,21 @@ func (s *Server) addRoute(method, path string, fn http.Handler, middlewares []Mi
 	}
 
 	// create handler function with server middlewares
-	middlewaresLen = len(s.middlewares)
+	fn = s.withServerMiddlewares(fn)
+
+	// the server middlewares can not change after the first route, create the automatic OPTIONS and not found handlers once
+	if s.optionsHandler == nil {
+		s.optionsHandler = s.withServerMiddlewares(http.HandlerFunc(serveAutomaticOptions))
+		s.notFound = s.withServerMiddlewares(http.HandlerFunc(s.serveNotFound))
+	}
+
+	// add route to router
+	s.router.addRoute(method, path, fn)
+}
+
+// withServerMiddlewares returns the handler wrapped with the server middlewares.
+func (s *Server) withServerMiddlewares(fn http.Handler) http.Handler {
+	middlewaresLen := len(s.middlewares)
 	if middlewaresLen > 0 {
 		for i := middlewaresLen - 1; i >= 0; i-- {
 			if s.middlewares[i].fn == nil {
@@ -245,8 +478,7 @@ func (s *Server) addRoute(method, path string, fn http.Handler, middlewares []Mi
 		}
 	}
 
-	// add route to router
-	s.router.addRoute(method, path, fn)
+	return fn
 }
 
 // createServeFilesHandler returns the http handler func for serving files.
@@ -15,6 +15,7 @@ import (
 	"os"
 	"reflect"
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -335,6 +336,21 @@ func TestServeHTTPNotFound(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "404")
 }
 
+func TestServeHTTPNotFoundMiddlewares(t *testing.T) {
+	srv := New()
+	srv.Use(srvMiddleware)
+	srv.SetNotFoundHandler(srvTestNotFoundHandler)
+
+	srv.GET("/testroute", routeHandler)
+
+	req, _ := http.NewRequest("GET", "/notfound", nil)
+	w := httptest.NewRecorder()
+
+	srv.ServeHTTP(w, req)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "srv-start"))
+	assert.Contains(t, w.Body.String(), "404")
+}
+
 func TestServeHTTPNotFoundDefault(t *testing.T) {
 	srv := New()
 
@@ -623,6 +639,50 @@ func TestShutdownTLS(t *testing.T) {
 	wg.Wait()
 }
 
+func TestServeHTTPAllocations(t *testing.T) {
+	srv := New()
+	srv.GET("/static/route", func(w http.ResponseWriter, r *http.Request) {})
+	srv.GET("/dynamic/:name", func(w http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+
+	// the params context and the request copy
+	for _, path := range []string{"/static/route", "/dynamic/abc"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		allocs := testing.AllocsPerRun(100, func() {
+			srv.ServeHTTP(w, req)
+		})
+
+		assert.LessOrEqual(t, allocs, float64(3), path)
+	}
+}
+
+func BenchmarkServeHTTPStatic(b *testing.B) {
+	srv := New()
+	srv.GET("/static/route", func(w http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/static/route", nil)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		srv.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkServeHTTPDynamic(b *testing.B) {
+	srv := New()
+	srv.GET("/dynamic/:name", func(w http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/dynamic/abc", nil)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		srv.ServeHTTP(w, req)
+	}
+}
+
 //----------------------------------------------------------------------------------------------------------------------
 func srvMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings is the serializable run configuration (e.g. loaded from a json file).
+// Durations use the `time.ParseDuration` format. Empty values are ignored.
+type Settings struct {
+	ReadTimeout               string `json:"readTimeout"`
+	ReadHeaderTimeout         string `json:"readHeaderTimeout"`
+	WriteTimeout              string `json:"writeTimeout"`
+	IdleTimeout               string `json:"idleTimeout"`
+	MaxHeaderBytes            int    `json:"maxHeaderBytes"`
+	MaxConnections            int    `json:"maxConnections"`
+	MaxInFlight               int    `json:"maxInFlight"`
+	KeepAlives                *bool  `json:"keepAlives"`
+	H2C                       bool   `json:"h2c"`
+	ShutdownDelay             string `json:"shutdownDelay"`
+	CertificateReloadInterval string `json:"certificateReloadInterval"`
+}
+
+// durationSetting is a duration value with its name and the Option it creates.
+type durationSetting struct {
+	name   string
+	env    string
+	value  *string
+	option func(time.Duration) Option
+}
+
+// durationSettings returns the duration settings of s.
+func (s *Settings) durationSettings() []durationSetting {
+	return []durationSetting{
+		{"ReadTimeout", "READ_TIMEOUT", &s.ReadTimeout, ReadTimeout},
+		{"ReadHeaderTimeout", "READ_HEADER_TIMEOUT", &s.ReadHeaderTimeout, ReadHeaderTimeout},
+		{"WriteTimeout", "WRITE_TIMEOUT", &s.WriteTimeout, WriteTimeout},
+		{"IdleTimeout", "IDLE_TIMEOUT", &s.IdleTimeout, IdleTimeout},
+		{"ShutdownDelay", "SHUTDOWN_DELAY", &s.ShutdownDelay, ShutdownDelay},
+		{"CertificateReloadInterval", "CERTIFICATE_RELOAD_INTERVAL", &s.CertificateReloadInterval, CertificateReloadInterval},
+	}
+}
+
+// intSetting is an integer value with its name and the Option it creates.
+type intSetting struct {
+	name   string
+	env    string
+	value  *int
+	option func(int) Option
+}
+
+// intSettings returns the integer settings of s.
+func (s *Settings) intSettings() []intSetting {
+	return []intSetting{
+		{"MaxHeaderBytes", "MAX_HEADER_BYTES", &s.MaxHeaderBytes, MaxHeaderBytes},
+		{"MaxConnections", "MAX_CONNECTIONS", &s.MaxConnections, MaxConnections},
+		{"MaxInFlight", "MAX_IN_FLIGHT", &s.MaxInFlight, MaxInFlight},
+	}
+}
+
+// OptionsFromSettings returns the Options for the given settings.
+// Returns an error if a value is invalid.
+func OptionsFromSettings(s Settings) ([]Option, error) {
+	options := []Option{}
+
+	for _, setting := range s.durationSettings() {
+		if *setting.value == "" {
+			continue
+		}
+
+		d, err := parseDurationSetting(*setting.value)
+		if err != nil {
+			return nil, settingError(setting.name, *setting.value, err)
+		}
+
+		options = append(options, setting.option(d))
+	}
+
+	for _, setting := range s.intSettings() {
+		if *setting.value < 0 {
+			return nil, settingError(setting.name, strconv.Itoa(*setting.value), errors.New("must not be negative"))
+		}
+
+		if *setting.value > 0 {
+			options = append(options, setting.option(*setting.value))
+		}
+	}
+
+	if s.KeepAlives != nil {
+		options = append(options, KeepAlives(*s.KeepAlives))
+	}
+
+	if s.H2C {
+		options = append(options, H2C())
+	}
+
+	return options, nil
+}
+
+// OptionsFromEnv returns the Options for the settings in the environment variables with the given prefix.
+// The variables are named like the Settings fields in upper snake case, e.g. with the prefix "APP":
+// APP_READ_TIMEOUT, APP_READ_HEADER_TIMEOUT, APP_WRITE_TIMEOUT, APP_IDLE_TIMEOUT, APP_MAX_HEADER_BYTES,
+// APP_MAX_CONNECTIONS, APP_MAX_IN_FLIGHT, APP_KEEP_ALIVES, APP_H2C, APP_SHUTDOWN_DELAY and APP_CERTIFICATE_RELOAD_INTERVAL.
+// Returns an error if a value is invalid.
+func OptionsFromEnv(prefix string) ([]Option, error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+
+	s := Settings{}
+
+	for _, setting := range s.durationSettings() {
+		value := os.Getenv(prefix + setting.env)
+		if value == "" {
+			continue
+		}
+
+		if _, err := parseDurationSetting(value); err != nil {
+			return nil, settingError(prefix+setting.env, value, err)
+		}
+
+		*setting.value = value
+	}
+
+	for _, setting := range s.intSettings() {
+		value := os.Getenv(prefix + setting.env)
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, settingError(prefix+setting.env, value, errors.New("must be an integer"))
+		}
+
+		if n < 0 {
+			return nil, settingError(prefix+setting.env, value, errors.New("must not be negative"))
+		}
+
+		*setting.value = n
+	}
+
+	if value := os.Getenv(prefix + "KEEP_ALIVES"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, settingError(prefix+"KEEP_ALIVES", value, errors.New("must be a boolean"))
+		}
+
+		s.KeepAlives = &enabled
+	}
+
+	if value := os.Getenv(prefix + "H2C"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, settingError(prefix+"H2C", value, errors.New("must be a boolean"))
+		}
+
+		s.H2C = enabled
+	}
+
+	return OptionsFromSettings(s)
+}
+
+// parseDurationSetting parses a duration setting, negative durations are invalid.
+func parseDurationSetting(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.New("must be a duration (e.g. 30s)")
+	}
+
+	if d < 0 {
+		return 0, errors.New("must not be negative")
+	}
+
+	return d, nil
+}
+
+// settingError returns the error for an invalid setting value.
+func settingError(name, value string, err error) error {
+	return fmt.Errorf("invalid value '%s' for %s: %v", value, name, err)
+}
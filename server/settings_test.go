@@ -0,0 +1,122 @@
+package server
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionsFromSettings(t *testing.T) {
+	keepAlives := false
+
+	options, err := OptionsFromSettings(Settings{
+		ReadTimeout:               "10s",
+		ReadHeaderTimeout:         "2s",
+		WriteTimeout:              "1m",
+		IdleTimeout:               "90s",
+		MaxHeaderBytes:            4096,
+		MaxConnections:            100,
+		MaxInFlight:               50,
+		KeepAlives:                &keepAlives,
+		H2C:                       true,
+		ShutdownDelay:             "5s",
+		CertificateReloadInterval: "0s",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, options, 11)
+
+	cfg := newConfig(options)
+	assert.Equal(t, 10*time.Second, cfg.srv.ReadTimeout)
+	assert.Equal(t, 2*time.Second, cfg.srv.ReadHeaderTimeout)
+	assert.Equal(t, time.Minute, cfg.srv.WriteTimeout)
+	assert.Equal(t, 90*time.Second, cfg.srv.IdleTimeout)
+	assert.Equal(t, 4096, cfg.srv.MaxHeaderBytes)
+	assert.Equal(t, 100, cfg.maxConnections)
+	assert.Equal(t, 50, cfg.maxInFlight)
+	assert.True(t, cfg.h2c)
+	assert.Equal(t, 5*time.Second, cfg.shutdownDelay)
+	assert.Equal(t, time.Duration(0), cfg.certificateReloadInterval)
+
+	options, err = OptionsFromSettings(Settings{})
+	assert.NoError(t, err)
+	assert.Len(t, options, 0)
+}
+
+func TestOptionsFromSettingsInvalid(t *testing.T) {
+	_, err := OptionsFromSettings(Settings{ReadTimeout: "abc"})
+	assert.EqualError(t, err, "invalid value 'abc' for ReadTimeout: must be a duration (e.g. 30s)")
+
+	_, err = OptionsFromSettings(Settings{IdleTimeout: "-1s"})
+	assert.EqualError(t, err, "invalid value '-1s' for IdleTimeout: must not be negative")
+
+	_, err = OptionsFromSettings(Settings{MaxHeaderBytes: -1})
+	assert.EqualError(t, err, "invalid value '-1' for MaxHeaderBytes: must not be negative")
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	env := map[string]string{
+		"APP_READ_TIMEOUT":     "10s",
+		"APP_WRITE_TIMEOUT":    "1m",
+		"APP_MAX_HEADER_BYTES": "4096",
+		"APP_MAX_IN_FLIGHT":    "50",
+		"APP_KEEP_ALIVES":      "false",
+		"APP_H2C":              "true",
+		"APP_SHUTDOWN_DELAY":   "5s",
+	}
+
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+	defer func() {
+		for k := range env {
+			os.Unsetenv(k)
+		}
+	}()
+
+	options, err := OptionsFromEnv("APP")
+	assert.NoError(t, err)
+	assert.Len(t, options, 7)
+
+	cfg := newConfig(options)
+	assert.Equal(t, 10*time.Second, cfg.srv.ReadTimeout)
+	assert.Equal(t, 5*time.Second, cfg.srv.ReadHeaderTimeout)
+	assert.Equal(t, time.Minute, cfg.srv.WriteTimeout)
+	assert.Equal(t, 4096, cfg.srv.MaxHeaderBytes)
+	assert.True(t, cfg.h2c)
+	assert.Equal(t, 5*time.Second, cfg.shutdownDelay)
+
+	options, err = OptionsFromEnv("APP_")
+	assert.NoError(t, err)
+	assert.Len(t, options, 7)
+
+	options, err = OptionsFromEnv("EMPTY")
+	assert.NoError(t, err)
+	assert.Len(t, options, 0)
+}
+
+func TestOptionsFromEnvInvalid(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		err   string
+	}{
+		{"APP_READ_TIMEOUT", "abc", "invalid value 'abc' for APP_READ_TIMEOUT: must be a duration (e.g. 30s)"},
+		{"APP_IDLE_TIMEOUT", "-5s", "invalid value '-5s' for APP_IDLE_TIMEOUT: must not be negative"},
+		{"APP_MAX_HEADER_BYTES", "1k", "invalid value '1k' for APP_MAX_HEADER_BYTES: must be an integer"},
+		{"APP_MAX_HEADER_BYTES", "-1", "invalid value '-1' for APP_MAX_HEADER_BYTES: must not be negative"},
+		{"APP_MAX_CONNECTIONS", "many", "invalid value 'many' for APP_MAX_CONNECTIONS: must be an integer"},
+		{"APP_KEEP_ALIVES", "maybe", "invalid value 'maybe' for APP_KEEP_ALIVES: must be a boolean"},
+		{"APP_H2C", "yes", "invalid value 'yes' for APP_H2C: must be a boolean"},
+	}
+
+	for _, test := range tests {
+		os.Setenv(test.key, test.value)
+
+		_, err := OptionsFromEnv("APP")
+		assert.EqualError(t, err, test.err)
+
+		os.Unsetenv(test.key)
+	}
+}
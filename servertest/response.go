@@ -0,0 +1,301 @@
+package servertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Response holds the recorded response of an executed request and provides chainable assertions.
+// Failed assertions are reported with t.Errorf, the test continues.
+type Response struct {
+	t testing.TB
+
+	// Recorder is the recorded response.
+	Recorder *httptest.ResponseRecorder
+}
+
+// Status asserts the status code.
+func (r *Response) Status(code int) *Response {
+	r.t.Helper()
+
+	if r.Recorder.Code != code {
+		r.t.Errorf("servertest: expected status %d, got %d (body: %q)", code, r.Recorder.Code, r.Recorder.Body.String())
+	}
+
+	return r
+}
+
+// Header asserts the value of a response header.
+func (r *Response) Header(key, value string) *Response {
+	r.t.Helper()
+
+	if actual := r.Recorder.Header().Get(key); actual != value {
+		r.t.Errorf("servertest: expected header %s to be %q, got %q", key, value, actual)
+	}
+
+	return r
+}
+
+// NoHeader asserts that a response header is not set.
+func (r *Response) NoHeader(key string) *Response {
+	r.t.Helper()
+
+	if values, ok := r.Recorder.Header()[http.CanonicalHeaderKey(key)]; ok {
+		r.t.Errorf("servertest: expected header %s to be missing, got %q", key, values)
+	}
+
+	return r
+}
+
+// Body asserts the response body.
+func (r *Response) Body(body string) *Response {
+	r.t.Helper()
+
+	if actual := r.Recorder.Body.String(); actual != body {
+		r.t.Errorf("servertest: expected body %q, got %q", body, actual)
+	}
+
+	return r
+}
+
+// BodyContains asserts that the response body contains s.
+func (r *Response) BodyContains(s string) *Response {
+	r.t.Helper()
+
+	if actual := r.Recorder.Body.String(); !strings.Contains(actual, s) {
+		r.t.Errorf("servertest: expected body to contain %q, got %q", s, actual)
+	}
+
+	return r
+}
+
+// Cookie asserts the value of a cookie set by the response.
+func (r *Response) Cookie(name, value string) *Response {
+	r.t.Helper()
+
+	cookie := r.findCookie(name)
+	if cookie == nil {
+		r.t.Errorf("servertest: expected cookie %s to be set", name)
+		return r
+	}
+
+	if cookie.Value != value {
+		r.t.Errorf("servertest: expected cookie %s to be %q, got %q", name, value, cookie.Value)
+	}
+
+	return r
+}
+
+// NoCookie asserts that a cookie is not set by the response.
+func (r *Response) NoCookie(name string) *Response {
+	r.t.Helper()
+
+	if cookie := r.findCookie(name); cookie != nil {
+		r.t.Errorf("servertest: expected cookie %s to be missing, got %q", name, cookie.Value)
+	}
+
+	return r
+}
+
+// JSON asserts that the response body is json equal to the given value.
+// The value is compared after a json roundtrip, e.g. map[string]interface{}{"id": 1} equals {"id":1}.
+func (r *Response) JSON(v interface{}) *Response {
+	r.t.Helper()
+
+	actual, err := r.decodeBody()
+	if err != nil {
+		r.t.Errorf("servertest: %v", err)
+		return r
+	}
+
+	expected, err := normalizeJSON(v)
+	if err != nil {
+		r.t.Errorf("servertest: encoding the expected value failed: %v", err)
+		return r
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		r.t.Errorf("servertest: expected json body %s, got %s", mustMarshal(expected), r.Recorder.Body.String())
+	}
+
+	return r
+}
+
+// JSONPath asserts the value at path in the json response body.
+// The path supports the root "$", fields ".name" or "['name']" and array indexes "[0]", e.g. "$.users[0].name".
+func (r *Response) JSONPath(path string, v interface{}) *Response {
+	r.t.Helper()
+
+	body, err := r.decodeBody()
+	if err != nil {
+		r.t.Errorf("servertest: %v", err)
+		return r
+	}
+
+	actual, err := lookupJSONPath(body, path)
+	if err != nil {
+		r.t.Errorf("servertest: %s: %v", path, err)
+		return r
+	}
+
+	expected, err := normalizeJSON(v)
+	if err != nil {
+		r.t.Errorf("servertest: encoding the expected value failed: %v", err)
+		return r
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		r.t.Errorf("servertest: expected %s to be %s, got %s", path, mustMarshal(expected), mustMarshal(actual))
+	}
+
+	return r
+}
+
+// DecodeJSON decodes the json response body into v.
+func (r *Response) DecodeJSON(v interface{}) *Response {
+	r.t.Helper()
+
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), v); err != nil {
+		r.t.Errorf("servertest: decoding the json body failed: %v", err)
+	}
+
+	return r
+}
+
+// findCookie returns the response cookie with the given name or nil.
+func (r *Response) findCookie(name string) *http.Cookie {
+	for _, cookie := range r.Recorder.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+
+	return nil
+}
+
+// decodeBody decodes the json response body.
+func (r *Response) decodeBody() (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), &v); err != nil {
+		return nil, fmt.Errorf("decoding the json body %q failed: %v", r.Recorder.Body.String(), err)
+	}
+
+	return v, nil
+}
+
+// normalizeJSON returns v after a json roundtrip.
+func normalizeJSON(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var normalized interface{}
+	err = json.Unmarshal(data, &normalized)
+
+	return normalized, err
+}
+
+// mustMarshal returns the json encoding of v for error messages.
+func mustMarshal(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+
+	return string(data)
+}
+
+// lookupJSONPath returns the value at path in the decoded json value v.
+func lookupJSONPath(v interface{}, path string) (interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path must start with $")
+	}
+
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+
+			name := rest[:end]
+			if name == "" {
+				return nil, fmt.Errorf("empty field name")
+			}
+
+			rest = rest[end:]
+
+			var err error
+			if v, err = lookupJSONField(v, name); err != nil {
+				return nil, err
+			}
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("missing ]")
+			}
+
+			segment := rest[1:end]
+			rest = rest[end+1:]
+
+			if len(segment) >= 2 && (segment[0] == '\'' || segment[0] == '"') && segment[len(segment)-1] == segment[0] {
+				var err error
+				if v, err = lookupJSONField(v, segment[1:len(segment)-1]); err != nil {
+					return nil, err
+				}
+
+				continue
+			}
+
+			index, err := strconv.Atoi(segment)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %q", segment)
+			}
+
+			array, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("index %d on non-array value %s", index, mustMarshal(v))
+			}
+
+			if index < 0 {
+				index += len(array)
+			}
+
+			if index < 0 || index >= len(array) {
+				return nil, fmt.Errorf("index %s out of range (length %d)", segment, len(array))
+			}
+
+			v = array[index]
+		default:
+			return nil, fmt.Errorf("unexpected %q", rest[0])
+		}
+	}
+
+	return v, nil
+}
+
+// lookupJSONField returns the field name of the decoded json object v.
+func lookupJSONField(v interface{}, name string) (interface{}, error) {
+	object, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("field %q on non-object value %s", name, mustMarshal(v))
+	}
+
+	field, ok := object[name]
+	if !ok {
+		return nil, fmt.Errorf("field %q not found", name)
+	}
+
+	return field, nil
+}
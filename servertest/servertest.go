@@ -0,0 +1,289 @@
+// Package servertest provides a fluent request builder and response assertions for testing http handlers in-process.
+//
+//	servertest.New(srv).GET("/users/1").WithHeader("Accept", "application/json").Expect(t).Status(200).JSONPath("$.name", "x")
+package servertest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Client executes requests in-process through the ServeHTTP method of a handler (e.g. a server.Server).
+// Create a new instance by using New().
+type Client struct {
+	handler http.Handler
+	header  http.Header
+	cookies []*http.Cookie
+}
+
+// New returns a Client for the given handler.
+func New(handler http.Handler) *Client {
+	return &Client{
+		handler: handler,
+		header:  http.Header{},
+	}
+}
+
+// WithHeader adds a header to all requests of the client.
+func (c *Client) WithHeader(key, value string) *Client {
+	c.header.Add(key, value)
+	return c
+}
+
+// WithCookie adds a cookie to all requests of the client.
+func (c *Client) WithCookie(name, value string) *Client {
+	c.cookies = append(c.cookies, &http.Cookie{Name: name, Value: value})
+	return c
+}
+
+// GET returns a GET request for the given path.
+func (c *Client) GET(path string) *Request {
+	return c.Request("GET", path)
+}
+
+// POST returns a POST request for the given path.
+func (c *Client) POST(path string) *Request {
+	return c.Request("POST", path)
+}
+
+// PUT returns a PUT request for the given path.
+func (c *Client) PUT(path string) *Request {
+	return c.Request("PUT", path)
+}
+
+// PATCH returns a PATCH request for the given path.
+func (c *Client) PATCH(path string) *Request {
+	return c.Request("PATCH", path)
+}
+
+// DELETE returns a DELETE request for the given path.
+func (c *Client) DELETE(path string) *Request {
+	return c.Request("DELETE", path)
+}
+
+// HEAD returns a HEAD request for the given path.
+func (c *Client) HEAD(path string) *Request {
+	return c.Request("HEAD", path)
+}
+
+// OPTIONS returns a OPTIONS request for the given path.
+func (c *Client) OPTIONS(path string) *Request {
+	return c.Request("OPTIONS", path)
+}
+
+// Request returns a request with the given method and path.
+func (c *Client) Request(method, path string) *Request {
+	header := http.Header{}
+	for k, v := range c.header {
+		header[k] = append([]string{}, v...)
+	}
+
+	return &Request{
+		client:  c,
+		method:  method,
+		path:    path,
+		header:  header,
+		query:   url.Values{},
+		cookies: append([]*http.Cookie{}, c.cookies...),
+		ctx:     context.Background(),
+	}
+}
+
+// multipartFile is a file of a multipart body.
+type multipartFile struct {
+	field, filename string
+	content         []byte
+}
+
+// Request is a request builder.
+// Create a new instance by using the Client methods.
+type Request struct {
+	client *Client
+
+	method  string
+	path    string
+	header  http.Header
+	query   url.Values
+	cookies []*http.Cookie
+	ctx     context.Context
+
+	body        []byte
+	contentType string
+
+	multipartFields url.Values
+	multipartFiles  []multipartFile
+
+	err error
+}
+
+// WithHeader adds a header to the request.
+func (r *Request) WithHeader(key, value string) *Request {
+	r.header.Add(key, value)
+	return r
+}
+
+// WithQuery adds a query parameter to the request.
+func (r *Request) WithQuery(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// WithCookie adds a cookie to the request.
+func (r *Request) WithCookie(name, value string) *Request {
+	r.cookies = append(r.cookies, &http.Cookie{Name: name, Value: value})
+	return r
+}
+
+// WithContext sets the context of the request.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r.ctx = ctx
+	return r
+}
+
+// WithBody sets the body with the given content type.
+func (r *Request) WithBody(contentType string, body []byte) *Request {
+	r.contentType = contentType
+	r.body = body
+	return r
+}
+
+// WithJSON sets the json encoded value as body.
+func (r *Request) WithJSON(v interface{}) *Request {
+	body, err := json.Marshal(v)
+	if err != nil {
+		r.err = err
+		return r
+	}
+
+	return r.WithBody("application/json", body)
+}
+
+// WithForm sets the url encoded form values as body.
+func (r *Request) WithForm(values url.Values) *Request {
+	return r.WithBody("application/x-www-form-urlencoded", []byte(values.Encode()))
+}
+
+// WithMultipartField adds a field to the multipart body.
+func (r *Request) WithMultipartField(name, value string) *Request {
+	if r.multipartFields == nil {
+		r.multipartFields = url.Values{}
+	}
+
+	r.multipartFields.Add(name, value)
+	return r
+}
+
+// WithMultipartFile adds a file to the multipart body.
+func (r *Request) WithMultipartFile(field, filename string, content []byte) *Request {
+	r.multipartFiles = append(r.multipartFiles, multipartFile{field: field, filename: filename, content: content})
+	return r
+}
+
+// Build returns the http.Request.
+func (r *Request) Build() (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	body := r.body
+	contentType := r.contentType
+
+	if r.multipartFields != nil || len(r.multipartFiles) > 0 {
+		buf := &bytes.Buffer{}
+		mw := multipart.NewWriter(buf)
+
+		for name, values := range r.multipartFields {
+			for _, value := range values {
+				if err := mw.WriteField(name, value); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		for _, file := range r.multipartFiles {
+			fw, err := mw.CreateFormFile(file.field, file.filename)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, err := fw.Write(file.content); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+
+		body = buf.Bytes()
+		contentType = mw.FormDataContentType()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	target := r.path
+	if len(r.query) > 0 {
+		separator := "?"
+		if strings.Contains(target, "?") {
+			separator = "&"
+		}
+
+		target += separator + r.query.Encode()
+	}
+
+	req := httptest.NewRequest(r.method, target, reader).WithContext(r.ctx)
+
+	for k, v := range r.header {
+		req.Header[k] = append([]string{}, v...)
+	}
+
+	if contentType != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	for _, cookie := range r.cookies {
+		req.AddCookie(cookie)
+	}
+
+	return req, nil
+}
+
+// Do executes the request and returns the recorded response.
+func (r *Request) Do() (*httptest.ResponseRecorder, error) {
+	req, err := r.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	w := httptest.NewRecorder()
+	r.client.handler.ServeHTTP(w, req)
+
+	return w, nil
+}
+
+// Expect executes the request and returns the Response for assertions.
+// Fails the test immediately if the request can not be built.
+func (r *Request) Expect(t testing.TB) *Response {
+	t.Helper()
+
+	w, err := r.Do()
+	if err != nil {
+		t.Fatalf("servertest: building the request %s %s failed: %v", r.method, r.path, err)
+	}
+
+	return &Response{
+		t:        t,
+		Recorder: w,
+	}
+}
@@ -0,0 +1,218 @@
+package servertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/fabysdev/fabyscore-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingTB is a testing.TB recording the failures instead of failing the test.
+type recordingTB struct {
+	testing.TB
+	errors []string
+	fatal  bool
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingTB) Fatalf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+	r.fatal = true
+}
+
+func newTestServer() *server.Server {
+	srv := server.New()
+
+	srv.GET("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":%s,"name":"x","tags":["a","b"],"header":%q,"query":%q}`, server.Param(r, "id"), r.Header.Get("X-Test"), r.URL.Query().Get("q"))
+	})
+
+	srv.POST("/users", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		body["contentType"] = r.Header.Get("Content-Type")
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(body)
+	})
+
+	srv.GET("/cookie", func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie("session")
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{Name: "echo", Value: c.Value})
+	})
+
+	srv.POST("/upload", func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		content, _ := ioutil.ReadAll(file)
+		fmt.Fprintf(w, "%s:%s:%s", r.FormValue("name"), header.Filename, content)
+	})
+
+	srv.POST("/form", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.FormValue("a")))
+	})
+
+	return srv
+}
+
+func TestGET(t *testing.T) {
+	New(newTestServer()).
+		GET("/users/1").
+		WithHeader("X-Test", "header").
+		WithQuery("q", "search").
+		Expect(t).
+		Status(http.StatusOK).
+		Header("Content-Type", "application/json").
+		NoHeader("X-Missing").
+		JSONPath("$.id", 1).
+		JSONPath("$.name", "x").
+		JSONPath("$.tags[1]", "b").
+		JSONPath("$.tags[-1]", "b").
+		JSONPath("$['header']", "header").
+		JSONPath("$.query", "search").
+		JSONPath("$.tags", []string{"a", "b"}).
+		BodyContains(`"name":"x"`)
+}
+
+func TestWithJSON(t *testing.T) {
+	var body struct {
+		Name        string `json:"name"`
+		ContentType string `json:"contentType"`
+	}
+
+	New(newTestServer()).
+		POST("/users").
+		WithJSON(map[string]string{"name": "y"}).
+		Expect(t).
+		Status(http.StatusCreated).
+		JSON(map[string]string{"name": "y", "contentType": "application/json"}).
+		DecodeJSON(&body)
+
+	assert.Equal(t, "y", body.Name)
+}
+
+func TestCookies(t *testing.T) {
+	client := New(newTestServer())
+
+	client.GET("/cookie").Expect(t).Status(http.StatusUnauthorized).NoCookie("echo")
+	client.GET("/cookie").WithCookie("session", "abc").Expect(t).Status(http.StatusOK).Cookie("echo", "abc")
+
+	client.WithCookie("session", "def")
+	client.GET("/cookie").Expect(t).Cookie("echo", "def")
+}
+
+func TestClientHeader(t *testing.T) {
+	client := New(newTestServer()).WithHeader("X-Test", "client")
+
+	client.GET("/users/1").Expect(t).JSONPath("$.header", "client")
+	client.GET("/users/1").WithHeader("X-Test", "request").Expect(t).JSONPath("$.header", "client")
+}
+
+func TestMultipart(t *testing.T) {
+	New(newTestServer()).
+		POST("/upload").
+		WithMultipartField("name", "doc").
+		WithMultipartFile("file", "a.txt", []byte("content")).
+		Expect(t).
+		Status(http.StatusOK).
+		Body("doc:a.txt:content")
+}
+
+func TestWithForm(t *testing.T) {
+	New(newTestServer()).
+		POST("/form").
+		WithForm(url.Values{"a": {"b"}}).
+		Expect(t).
+		Body("b")
+}
+
+func TestBuild(t *testing.T) {
+	req, err := New(http.NotFoundHandler()).GET("/a?b=1").WithQuery("c", "2").WithBody("text/plain", []byte("x")).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, "/a?b=1&c=2", req.URL.RequestURI())
+	assert.Equal(t, "text/plain", req.Header.Get("Content-Type"))
+
+	_, err = New(http.NotFoundHandler()).POST("/").WithJSON(make(chan int)).Build()
+	assert.Error(t, err)
+}
+
+func TestExpectBuildError(t *testing.T) {
+	tb := &recordingTB{}
+	New(newTestServer()).POST("/users").WithJSON(make(chan int)).Expect(tb)
+
+	assert.True(t, tb.fatal)
+}
+
+func TestFailedAssertions(t *testing.T) {
+	tb := &recordingTB{}
+
+	New(newTestServer()).
+		GET("/users/1").
+		Expect(tb).
+		Status(http.StatusCreated).
+		Header("Content-Type", "text/plain").
+		NoHeader("Content-Type").
+		Body("x").
+		BodyContains("zzz").
+		Cookie("session", "a").
+		JSON(map[string]string{}).
+		JSONPath("$.name", "y").
+		JSONPath("$.missing", "y").
+		JSONPath("$.tags[5]", "y").
+		JSONPath("$.name[0]", "y").
+		JSONPath("name", "y")
+
+	assert.Len(t, tb.errors, 12)
+	assert.Contains(t, tb.errors[0], "expected status 201, got 200")
+	assert.Contains(t, tb.errors[7], `expected $.name to be "y", got "x"`)
+	assert.Contains(t, tb.errors[8], `field "missing" not found`)
+	assert.Contains(t, tb.errors[9], "out of range")
+	assert.False(t, tb.fatal)
+}
+
+func TestLookupJSONPath(t *testing.T) {
+	var v interface{}
+	json.Unmarshal([]byte(`{"a":{"b c":[{"d":1}]}}`), &v)
+
+	value, err := lookupJSONPath(v, "$")
+	assert.NoError(t, err)
+	assert.Equal(t, v, value)
+
+	value, err = lookupJSONPath(v, "$.a['b c'][0].d")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), value)
+
+	_, err = lookupJSONPath(v, "$.a[0")
+	assert.Error(t, err)
+
+	_, err = lookupJSONPath(v, "$.a[x]")
+	assert.Error(t, err)
+
+	_, err = lookupJSONPath(v, "$.")
+	assert.Error(t, err)
+}